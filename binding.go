@@ -0,0 +1,376 @@
+package wygo
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 各个来源在结构体tag中的名字，例如 `query:"page" path:"id" header:"X-Tenant" form:"name"`
+// 只有写了对应tag的字段才会从这个来源绑定，tag为-时跳过
+const (
+	sourceQuery  = "query"
+	sourcePath   = "path"
+	sourceHeader = "header"
+	sourceForm   = "form"
+)
+
+// BindingError 描述一个字段绑定失败的原因
+type BindingError struct {
+	Field  string // 结构体中的字段名，嵌套的字段用.连接
+	Name   string // tag中写的名字，也就是请求里的参数名
+	Source string // query、path、header或form
+	Value  string
+	Err    error
+}
+
+func (e *BindingError) Error() string {
+	if e.Name == "" {
+		return "wygo: " + e.Err.Error()
+	}
+	return fmt.Sprintf("wygo: cannot bind %s %q (%q) to field %s: %v", e.Source, e.Name, e.Value, e.Field, e.Err)
+}
+
+func (e *BindingError) Unwrap() error {
+	return e.Err
+}
+
+// BindingErrors 收集一次绑定中所有失败的字段，不会因为第一个错误就停下
+type BindingErrors []*BindingError
+
+func (errs BindingErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Bind 根据Content-Type选择解码方式：JSON、XML、url-encoded表单或multipart表单
+// 没有Content-Type时（比如GET请求）按表单处理，也就是从query中按form tag绑定
+// 和其他Bind方法一样，绑定成功后会按validate tag校验，返回的错误可以交给AbortWithBindError
+func (c *Context) Bind(obj interface{}) error {
+	return c.bindAndValidate(obj, c.bindBody)
+}
+
+// BindJson 将body中的JSON解析到obj中
+func (c *Context) BindJson(obj interface{}) error {
+	return c.bindAndValidate(obj, c.bindJSON)
+}
+
+// BindXML 将body中的XML解析到obj中
+func (c *Context) BindXML(obj interface{}) error {
+	return c.bindAndValidate(obj, c.bindXML)
+}
+
+// BindForm 将query和表单中的值按form tag绑定到obj中，表单中的值优先
+func (c *Context) BindForm(obj interface{}) error {
+	return c.bindAndValidate(obj, c.bindForm)
+}
+
+// BindQuery 将url中的query按query tag绑定到obj中
+func (c *Context) BindQuery(obj interface{}) error {
+	return c.bindAndValidate(obj, c.bindQuery)
+}
+
+// BindURI 将路由参数按path tag绑定到obj中，例如 /user/:id 对应 `path:"id"`
+func (c *Context) BindURI(obj interface{}) error {
+	return c.bindAndValidate(obj, c.bindURI)
+}
+
+// BindHeader 将请求头按header tag绑定到obj中，header名不区分大小写
+func (c *Context) BindHeader(obj interface{}) error {
+	return c.bindAndValidate(obj, c.bindHeader)
+}
+
+// BindAll 把body、query、路由参数和请求头合并绑定到同一个结构体中，每个字段从它tag对应的来源取值
+// body按Content-Type解码，没有body时跳过；body解析失败直接返回，其他来源的字段错误会一起返回
+// 所有来源都绑定完之后才做校验
+func (c *Context) BindAll(obj interface{}) error {
+	return c.bindAndValidate(obj, c.bindAll)
+}
+
+// 先绑定再校验，绑定失败时直接返回绑定的错误
+func (c *Context) bindAndValidate(obj interface{}, bind func(interface{}) error) error {
+	if err := bind(obj); err != nil {
+		return err
+	}
+	return c.Validate(obj)
+}
+
+func (c *Context) bindBody(obj interface{}) error {
+	switch c.contentType() {
+	case "application/json":
+		return c.bindJSON(obj)
+	case "application/xml", "text/xml":
+		return c.bindXML(obj)
+	default:
+		return c.bindForm(obj)
+	}
+}
+
+func (c *Context) bindJSON(obj interface{}) error {
+	body, err := c.readBody()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, obj)
+}
+
+func (c *Context) bindXML(obj interface{}) error {
+	body, err := c.readBody()
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(body, obj)
+}
+
+func (c *Context) bindForm(obj interface{}) error {
+	if c.Req == nil {
+		return errors.New("Request Empty")
+	}
+	// multipart表单中的文件同样要满足上传限制
+	if c.contentType() == "multipart/form-data" {
+		if _, err := c.MultipartForm(); err != nil {
+			return err
+		}
+	} else if err := c.Req.ParseForm(); err != nil {
+		return err
+	}
+	return bindValues(obj, sourceForm, valuesGetter(c.Req.Form))
+}
+
+func (c *Context) bindQuery(obj interface{}) error {
+	if c.Req == nil {
+		return errors.New("Request Empty")
+	}
+	return bindValues(obj, sourceQuery, valuesGetter(c.Req.URL.Query()))
+}
+
+func (c *Context) bindURI(obj interface{}) error {
+	return bindValues(obj, sourcePath, func(name string) ([]string, bool) {
+		value, ok := c.Params[name]
+		return []string{value}, ok
+	})
+}
+
+func (c *Context) bindHeader(obj interface{}) error {
+	if c.Req == nil {
+		return errors.New("Request Empty")
+	}
+	return bindValues(obj, sourceHeader, func(name string) ([]string, bool) {
+		values := c.Req.Header.Values(name)
+		return values, len(values) > 0
+	})
+}
+
+func (c *Context) bindAll(obj interface{}) error {
+	if c.hasBody() {
+		if err := c.bindBody(obj); err != nil {
+			return err
+		}
+	}
+	var errs BindingErrors
+	for _, bind := range []func(interface{}) error{c.bindQuery, c.bindURI, c.bindHeader} {
+		err := bind(obj)
+		if err == nil {
+			continue
+		}
+		var fieldErrs BindingErrors
+		if !errors.As(err, &fieldErrs) {
+			return err
+		}
+		errs = append(errs, fieldErrs...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// 返回去掉参数后的Content-Type，例如 application/json; charset=utf-8 返回 application/json
+func (c *Context) contentType() string {
+	if c.Req == nil {
+		return ""
+	}
+	ct := c.Req.Header.Get("Content-Type")
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+// 判断请求是否带了body，GET请求一般没有
+func (c *Context) hasBody() bool {
+	return c.Req != nil && c.Req.Body != nil && c.Req.Body != http.NoBody && c.Req.ContentLength != 0
+}
+
+// 读出整个body，并重新放回Req.Body，后面的handler还可以再读
+func (c *Context) readBody() ([]byte, error) {
+	if c.Req == nil {
+		return nil, errors.New("Request Empty")
+	}
+	if c.Req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(c.Req.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Req.Body = io.NopCloser(bytes.NewBuffer(body))
+	return body, nil
+}
+
+// 按名字取某个来源中的值，ok为false表示请求中没有这个参数
+type valueGetter func(name string) (values []string, ok bool)
+
+func valuesGetter(values map[string][]string) valueGetter {
+	return func(name string) ([]string, bool) {
+		vs, ok := values[name]
+		return vs, ok && len(vs) > 0
+	}
+}
+
+// 遍历obj的字段，把tag对应来源中的值转换后赋给字段，请求中没有的参数保持字段原来的值
+func bindValues(obj interface{}, tag string, get valueGetter) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("wygo: bind target must be a non-nil pointer to struct, got %T", obj)
+	}
+	var errs BindingErrors
+	bindStruct(v.Elem(), "", tag, get, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func bindStruct(v reflect.Value, prefix string, tag string, get valueGetter, errs *BindingErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		name, ok := sf.Tag.Lookup(tag)
+		if !ok {
+			// 没有tag的结构体字段（包括内嵌的）继续绑定里面的字段
+			if sf.Type.Kind() == reflect.Struct && !isScalarType(sf.Type) {
+				bindStruct(fv, prefix+sf.Name+".", tag, get, errs)
+			}
+			continue
+		}
+		if name = strings.Split(name, ",")[0]; name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		values, ok := get(name)
+		if !ok {
+			continue
+		}
+		if err := setField(fv, values); err != nil {
+			*errs = append(*errs, &BindingError{
+				Field:  prefix + sf.Name,
+				Name:   name,
+				Source: tag,
+				Value:  values[len(values)-1],
+				Err:    err,
+			})
+		}
+	}
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// 能够直接从一个字符串转换过来的类型，结构体只有实现了TextUnmarshaler（比如time.Time）才算
+func isScalarType(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// 切片字段使用所有的值，其他字段和QueryInt等方法一样使用最后一个值
+func setField(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && !isScalarType(v.Type()) {
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setValue(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return setValue(v, values[len(values)-1])
+}
+
+// 把字符串s转换成v的类型并赋值，非字符串类型的空值保持零值
+func setValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setValue(v.Elem(), s)
+	}
+	if isScalarType(v.Type()) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if v.Kind() == reflect.String {
+		v.SetString(s)
+		return nil
+	}
+	if s == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
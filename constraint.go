@@ -0,0 +1,106 @@
+package wygo
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 路径参数的约束，返回false时这个参数节点不匹配，继续尝试其他路由
+type paramConstraint func(value string) bool
+
+// 内置的约束类型，可以写成 :id<int> 或者 :id|int
+var builtinConstraints = map[string]paramConstraint{
+	"int": func(v string) bool {
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+	},
+	"uint": func(v string) bool {
+		_, err := strconv.ParseUint(v, 10, 64)
+		return err == nil
+	},
+	"float": func(v string) bool {
+		_, err := strconv.ParseFloat(v, 64)
+		return err == nil
+	},
+	"alpha": func(v string) bool {
+		for i := 0; i < len(v); i++ {
+			if !isAlpha(v[i]) {
+				return false
+			}
+		}
+		return true
+	},
+	"alnum": func(v string) bool {
+		for i := 0; i < len(v); i++ {
+			if !isAlpha(v[i]) && !isDigit(v[i]) {
+				return false
+			}
+		}
+		return true
+	},
+	"uuid": isUUID,
+}
+
+func isAlpha(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// 形如 123e4567-e89b-12d3-a456-426614174000
+func isUUID(v string) bool {
+	if len(v) != 36 {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			if v[i] != '-' {
+				return false
+			}
+		} else if !isHex(v[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// 解析参数片段，例如 :id<int>、:slug<[a-z0-9-]+>、:ver|uuid、*filepath
+// 返回参数名、约束的原始文本和约束函数，没有约束时后两个为空
+// <>中不是内置类型名时按正则处理，正则需要匹配整个路径段，并且不能包含/，否则注册时panic
+func parseParamToken(token string) (key string, text string, check paramConstraint) {
+	key = token[1:]
+	if token[0] != ':' {
+		return key, "", nil
+	}
+	if i := strings.IndexByte(key, '<'); i >= 0 {
+		// pattern先按/拆成路径段，正则中的/会把约束截断
+		if key[len(key)-1] != '>' {
+			panic(fmt.Sprintf("wygo: unclosed constraint in %s, constraints must not contain /", token))
+		}
+		key, text = key[:i], key[i+1:len(key)-1]
+		if check = builtinConstraints[text]; check == nil {
+			re, err := regexp.Compile("^(?:" + text + ")$")
+			if err != nil {
+				panic(fmt.Sprintf("wygo: invalid constraint in %s: %v", token, err))
+			}
+			check = re.MatchString
+		}
+	} else if i := strings.IndexByte(key, '|'); i >= 0 {
+		key, text = key[:i], key[i+1:]
+		if check = builtinConstraints[text]; check == nil {
+			panic(fmt.Sprintf("wygo: unknown constraint type %s in %s", text, token))
+		}
+	}
+	if key == "" {
+		panic(fmt.Sprintf("wygo: param %s must have a name", token))
+	}
+	return key, text, check
+}
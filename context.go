@@ -1,16 +1,13 @@
 package wygo
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
 	"math"
+	"mime/multipart"
 	"net/http"
 	"net/url"
-	"strconv"
 	"sync"
 	"time"
 )
@@ -21,12 +18,14 @@ const AbortIndex = math.MaxInt16 >> 1
 
 type Context struct {
 	// 原生的ResponseWriter和Request
+	// Writer默认是记录了状态码和写入字节数的ResponseWriter，中间件可以替换它
 	Writer http.ResponseWriter
 	Req    *http.Request
+	writer responseWriter
 	// 封装request的context
 	Ctx context.Context
 	// Request的一些常用字段的直接访问
-	mu     *sync.RWMutex
+	mu     sync.RWMutex
 	Method string
 	Path   string
 	// 存储的params数组，提供对路由参数的访问
@@ -40,17 +39,63 @@ type Context struct {
 	engine *Engine
 	// 存储的信息
 	Kv map[string]any
+	// 通过Key[T]存储的信息，以*Key[T]为键，不会和Kv中的字符串键冲突
+	keys map[any]any
+	// MultipartForm对上传文件的检查结果，同一个请求只检查一次
+	multipartChecked bool
+	multipartErr     error
 }
 
-func newContext(w http.ResponseWriter, r *http.Request) *Context {
-	return &Context{
-		Writer:       w,
-		Req:          r,
-		Ctx:          r.Context(),
-		Path:         r.URL.Path,
-		Method:       r.Method,
-		handlerIndex: -1,
+// Context由Engine的sync.Pool复用，每个请求开始前重置所有字段
+func (c *Context) reset(w http.ResponseWriter, r *http.Request) {
+	c.Writer = c.writer.reset(w)
+	c.Req = r
+	c.Ctx = r.Context()
+	c.Path = r.URL.Path
+	c.Method = r.Method
+	c.Params = nil
+	c.StatusCode = 0
+	c.handlers = nil
+	c.handlerIndex = -1
+	c.Kv = nil
+	c.keys = nil
+	c.multipartChecked = false
+	c.multipartErr = nil
+}
+
+// Copy 返回一个可以在请求结束后交给goroutine使用的副本
+// 副本中的Params和Kv是复制出来的，不再有handler可以执行，也不能用来写响应
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		Req:          c.Req,
+		Ctx:          c.Ctx,
+		Method:       c.Method,
+		Path:         c.Path,
+		StatusCode:   c.StatusCode,
+		handlerIndex: AbortIndex,
+		engine:       c.engine,
+	}
+	if c.Params != nil {
+		cp.Params = make(map[string]string, len(c.Params))
+		for k, v := range c.Params {
+			cp.Params[k] = v
+		}
+	}
+	c.mu.RLock()
+	if c.Kv != nil {
+		cp.Kv = make(map[string]any, len(c.Kv))
+		for k, v := range c.Kv {
+			cp.Kv[k] = v
+		}
 	}
+	if c.keys != nil {
+		cp.keys = make(map[any]any, len(c.keys))
+		for k, v := range c.keys {
+			cp.keys[k] = v
+		}
+	}
+	c.mu.RUnlock()
+	return cp
 }
 
 func (c *Context) GetHandlers() []HandlerFunc {
@@ -95,7 +140,7 @@ func (c *Context) Abort() {
 }
 
 func (c *Context) Mux() *sync.RWMutex {
-	return c.mu
+	return &c.mu
 }
 
 func (c *Context) GetRequest() *http.Request {
@@ -106,6 +151,16 @@ func (c *Context) SetRequest(r *http.Request) {
 	c.Req = r
 }
 
+// Response 返回包装过的ResponseWriter，即使Writer被中间件替换过，也能拿到最终的状态码和写入的字节数
+func (c *Context) Response() ResponseWriter {
+	return c.writer.wrap()
+}
+
+// Status 返回响应的状态码，没有设置过时为200
+func (c *Context) Status() int {
+	return c.writer.Status()
+}
+
 func (c *Context) GetRespnse() http.ResponseWriter {
 	return c.Writer
 }
@@ -114,6 +169,16 @@ func (c *Context) SetResponse(w http.ResponseWriter) {
 	c.Writer = w
 }
 
+// Proto 返回请求使用的协议，例如 HTTP/1.1、HTTP/2.0
+func (c *Context) Proto() string {
+	return c.Req.Proto
+}
+
+// IsHTTP2 判断请求是否通过HTTP/2（包括h2c）发送
+func (c *Context) IsHTTP2() bool {
+	return c.Req.ProtoMajor == 2
+}
+
 func (c *Context) BaseContext() context.Context {
 	return c.Ctx
 }
@@ -131,7 +196,19 @@ func (c *Context) Err() error {
 	return c.BaseContext().Err()
 }
 
+// Value 依次查找Key[T]存储的值、Kv中的字符串键，最后是请求的context
 func (c *Context) Value(key any) any {
+	c.mu.RLock()
+	value, ok := c.keys[key]
+	if !ok {
+		if k, isString := key.(string); isString {
+			value, ok = c.Kv[k]
+		}
+	}
+	c.mu.RUnlock()
+	if ok {
+		return value
+	}
 	return c.BaseContext().Value(key)
 }
 
@@ -142,32 +219,46 @@ type IRequest interface {
 	QueryInt64(key string, defaultValue int64) int64
 	QueryFloat64(key string, defaultValue float64) float64
 	QueryFloat32(key string, defaultValue float32) float32
-	//QueryBool(key string, defaultValue bool) (bool, bool)
+	QueryBool(key string, defaultValue bool) bool
 	QueryString(key string, defaultValue string) string
 	QueryStringSlice(key string, defaultValue []string) []string
+	// 返回未转换的值，可以通过Int()、Bool()、Time()等方法拿到解析错误
+	QueryValue(key string) RequestValue
 	// Param相关，也就是/:id这样的
 	Param(key string) interface{}
 	ParamInt(key string, defaultValue int) int
 	ParamInt64(key string, defaultValue int64) int64
 	ParamFloat64(key string, defaultValue float64) float64
 	ParamFloat32(key string, defaultValue float32) float32
-	//ParamBool(key string, defaultValue bool) (bool, bool)
+	ParamBool(key string, defaultValue bool) bool
 	ParamString(key string, defaultValue string) string
+	ParamValue(key string) RequestValue
 	// Form表单数据的获取
 	PostForm(key string) string
 	PostFormInt(key string, defaultValue int) int
 	PostFormInt64(key string, defaultValue int64) int64
 	PostFormFloat64(key string, defaultValue float64) float64
 	PostFormFloat32(key string, defaultValue float32) float32
-	//PostFormBool(key string, defaultValue bool) (bool, bool)
+	PostFormBool(key string, defaultValue bool) bool
 	//PostFormString(key string) string
+	PostFormValue(key string) RequestValue
 
 	// 将body文本解析到obj中
 	BindJson(obj interface{}) error
+	BindXML(obj interface{}) error
+	// 按Content-Type自动选择解码方式
+	Bind(obj interface{}) error
+	// 按结构体tag从各个来源绑定，BindAll会合并所有来源
+	BindForm(obj interface{}) error
+	BindQuery(obj interface{}) error
+	BindURI(obj interface{}) error
+	BindHeader(obj interface{}) error
+	BindAll(obj interface{}) error
 
 	//PostFormStringSlice(key string, defaultValue []string) (string, bool)
-	//PostFormFile(key string) (*multipart.FileHeader, error)
-	//BindXML(obj interface{}) error
+	PostFormFile(key string) (*multipart.FileHeader, error)
+	FormFile(name string) (*multipart.FileHeader, error)
+	MultipartForm() (*multipart.Form, error)
 
 	//Uri() string
 	//Method() string
@@ -212,58 +303,38 @@ func (c *Context) QueryAll() map[string][]string {
 	return map[string][]string{}
 }
 
+// 以下方法解析失败时返回defaultValue，需要知道错误时使用QueryValue
 func (c *Context) QueryInt(key string, defaultValue int) int {
-	params := c.QueryAll()
-	if vals, ok := params[key]; ok {
-		if len(vals) > 0 {
-			valInt, err := strconv.Atoi(vals[len(vals)-1])
-			if err != nil {
-				return defaultValue
-			}
-			return valInt
-		}
+	if value, err := c.QueryValue(key).Int(); err == nil {
+		return value
 	}
 	return defaultValue
 }
 
 func (c *Context) QueryInt64(key string, defaultValue int64) int64 {
-	params := c.QueryAll()
-	if vals, ok := params[key]; ok {
-		if len(vals) > 0 {
-			valInt64, err := strconv.Atoi(vals[len(vals)-1])
-			if err != nil {
-				return defaultValue
-			}
-			return int64(valInt64)
-		}
+	if value, err := c.QueryValue(key).Int64(); err == nil {
+		return value
 	}
 	return defaultValue
 }
 
 func (c *Context) QueryFloat64(key string, defaultValue float64) float64 {
-	params := c.QueryAll()
-	if vals, ok := params[key]; ok {
-		if len(vals) > 0 {
-			valFloat64, err := strconv.ParseFloat(vals[len(vals)-1], 64)
-			if err != nil {
-				return defaultValue
-			}
-			return valFloat64
-		}
+	if value, err := c.QueryValue(key).Float64(); err == nil {
+		return value
 	}
 	return defaultValue
 }
 
 func (c *Context) QueryFloat32(key string, defaultValue float32) float32 {
-	params := c.QueryAll()
-	if vals, ok := params[key]; ok {
-		if len(vals) > 0 {
-			valFloat32, err := strconv.ParseFloat(vals[len(vals)-1], 32)
-			if err != nil {
-				return defaultValue
-			}
-			return float32(valFloat32)
-		}
+	if value, err := c.QueryValue(key).Float32(); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func (c *Context) QueryBool(key string, defaultValue bool) bool {
+	if value, err := c.QueryValue(key).Bool(); err == nil {
+		return value
 	}
 	return defaultValue
 }
@@ -291,46 +362,38 @@ func (c *Context) Param(key string) interface{} {
 	return value
 }
 
+// 解析失败时返回defaultValue，需要知道错误时使用ParamValue
 func (c *Context) ParamInt(key string, defaultValue int) int {
-	if value, ok := c.Params[key]; ok {
-		valInt, err := strconv.Atoi(value)
-		if err != nil {
-			return defaultValue
-		}
-		return valInt
+	if value, err := c.ParamValue(key).Int(); err == nil {
+		return value
 	}
 	return defaultValue
 }
 
 func (c *Context) ParamInt64(key string, defaultValue int64) int64 {
-	if value, ok := c.Params[key]; ok {
-		valInt64, err := strconv.Atoi(value)
-		if err != nil {
-			return defaultValue
-		}
-		return int64(valInt64)
+	if value, err := c.ParamValue(key).Int64(); err == nil {
+		return value
 	}
 	return defaultValue
 }
 
 func (c *Context) ParamFloat64(key string, defaultValue float64) float64 {
-	if value, ok := c.Params[key]; ok {
-		valFloat64, err := strconv.ParseFloat(value, 64)
-		if err != nil {
-			return defaultValue
-		}
-		return valFloat64
+	if value, err := c.ParamValue(key).Float64(); err == nil {
+		return value
 	}
 	return defaultValue
 }
 
 func (c *Context) ParamFloat32(key string, defaultValue float32) float32 {
-	if value, ok := c.Params[key]; ok {
-		valFloat32, err := strconv.ParseFloat(value, 32)
-		if err != nil {
-			return defaultValue
-		}
-		return float32(valFloat32)
+	if value, err := c.ParamValue(key).Float32(); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func (c *Context) ParamBool(key string, defaultValue bool) bool {
+	if value, err := c.ParamValue(key).Bool(); err == nil {
+		return value
 	}
 	return defaultValue
 }
@@ -344,59 +407,47 @@ func (c *Context) ParamString(key string, defaultValue string) string {
 
 // 一些便捷方法的封装，包括Req和Resp
 func (c *Context) PostForm(key string) string {
+	c.parseMultipartForm()
 	return c.Req.FormValue(key)
 }
 
+// 解析失败时返回defaultValue，需要知道错误时使用PostFormValue
 func (c *Context) PostFormInt(key string, defaultValue int) int {
-	valInt, err := strconv.Atoi(c.PostForm(key))
-	if err != nil {
-		return defaultValue
+	if value, err := c.PostFormValue(key).Int(); err == nil {
+		return value
 	}
-	return valInt
+	return defaultValue
 }
 
 func (c *Context) PostFormInt64(key string, defaultValue int64) int64 {
-	valInt64, err := strconv.Atoi(c.PostForm(key))
-	if err != nil {
-		return defaultValue
+	if value, err := c.PostFormValue(key).Int64(); err == nil {
+		return value
 	}
-	return int64(valInt64)
+	return defaultValue
 }
 
 func (c *Context) PostFormFloat64(key string, defaultValue float64) float64 {
-	valFloat64, err := strconv.ParseFloat(c.PostForm(key), 64)
-	if err != nil {
-		return defaultValue
+	if value, err := c.PostFormValue(key).Float64(); err == nil {
+		return value
 	}
-	return valFloat64
+	return defaultValue
 }
 
 func (c *Context) PostFormFloat32(key string, defaultValue float32) float32 {
-	valFloat32, err := strconv.ParseFloat(c.PostForm(key), 32)
-	if err != nil {
-		return defaultValue
+	if value, err := c.PostFormValue(key).Float32(); err == nil {
+		return value
 	}
-	return float32(valFloat32)
+	return defaultValue
 }
 
-func (c *Context) BindJson(obj interface{}) error {
-	if c.Req != nil {
-		body, err := io.ReadAll(c.Req.Body)
-		if err != nil {
-			return err
-		}
-		// 因为Body只能读一次，后面会读不到，所以再构建一个赋值给之前的Body
-		c.Req.Body = io.NopCloser(bytes.NewBuffer(body))
-		err = json.Unmarshal(body, obj)
-		if err != nil {
-			return err
-		}
-	} else {
-		return errors.New("Request Empty")
+func (c *Context) PostFormBool(key string, defaultValue bool) bool {
+	if value, err := c.PostFormValue(key).Bool(); err == nil {
+		return value
 	}
-	return nil
+	return defaultValue
 }
 
+// SetStatusCode 设置状态码，header会在第一次写body时才写出，所以之前可以再修改
 func (c *Context) SetStatusCode(statusCode int) IResponse {
 	c.Writer.WriteHeader(statusCode)
 	c.StatusCode = statusCode
@@ -421,13 +472,11 @@ func (c *Context) SetCookie(key string, val string, maxAge int, path, domain str
 }
 
 func (c *Context) SetStatusOK() IResponse {
-	c.Writer.WriteHeader(http.StatusOK)
-	return c
+	return c.SetStatusCode(http.StatusOK)
 }
 
 func (c *Context) SetStatusInternalServerError() IResponse {
-	c.Writer.WriteHeader(http.StatusInternalServerError)
-	return c
+	return c.SetStatusCode(http.StatusInternalServerError)
 }
 
 func (c *Context) SetHeader(key string, value string) IResponse {
@@ -448,12 +497,14 @@ func (c *Context) String(format string, values ...interface{}) IResponse {
 	return c
 }
 
+// 先编码再写出，编码失败时不会留下写了一半的body
 func (c *Context) JSON(obj interface{}) IResponse {
-	c.SetHeader("Content-Type", "application/json")
-	encoder := json.NewEncoder(c.Writer)
-	if err := encoder.Encode(obj); err != nil {
-		c.SetStatusCode(http.StatusInternalServerError)
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return c.SetStatusCode(http.StatusInternalServerError)
 	}
+	c.SetHeader("Content-Type", "application/json")
+	c.Writer.Write(append(data, '\n'))
 	return c
 }
 
@@ -1,3 +1,7 @@
 module github.com/enginewang/wygo
 
-go 1.19
\ No newline at end of file
+go 1.19
+
+require golang.org/x/net v0.35.0
+
+require golang.org/x/text v0.22.0 // indirect
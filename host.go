@@ -0,0 +1,144 @@
+package wygo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// hostRoutes 保存限定了Host的路由，例如 api.example.com 或者 :tenant.example.com
+type hostRoutes struct {
+	pattern string
+	labels  []string // 按.拆开的pattern，以:开头的是参数
+	hasWild bool
+	// 对于每种类型的方法，存各个方法的根节点
+	roots map[string]*node
+}
+
+func newHostRoutes(pattern string) *hostRoutes {
+	h := &hostRoutes{pattern: pattern, labels: strings.Split(pattern, "."), roots: make(map[string]*node)}
+	for _, label := range h.labels {
+		if label == "" || label == ":" {
+			panic(fmt.Sprintf("wygo: invalid host pattern %s", pattern))
+		}
+		h.hasWild = h.hasWild || label[0] == ':'
+	}
+	return h
+}
+
+// 去掉Host中的端口，例如 api.example.com:8080 返回 api.example.com
+func stripPort(host string) string {
+	i := strings.LastIndexByte(host, ':')
+	if i < 0 {
+		return host
+	}
+	for j := i + 1; j < len(host); j++ {
+		if !isDigit(host[j]) {
+			return host
+		}
+	}
+	return host[:i]
+}
+
+// 判断host是否匹配，静态部分不区分大小写，ps不为nil时会把Host中的参数追加到ps中
+func (h *hostRoutes) match(host string, ps *routeParams) bool {
+	host = stripPort(host)
+	mark := 0
+	if ps != nil {
+		mark = len(*ps)
+	}
+	for i, label := range h.labels {
+		value := host
+		if i < len(h.labels)-1 {
+			end := strings.IndexByte(host, '.')
+			if end < 0 {
+				break
+			}
+			value, host = host[:end], host[end+1:]
+		} else if strings.IndexByte(host, '.') >= 0 {
+			break
+		}
+		if label[0] == ':' {
+			if value == "" {
+				break
+			}
+			if ps != nil {
+				*ps = append(*ps, routeParam{key: label[1:], value: value})
+			}
+		} else if !strings.EqualFold(label, value) {
+			break
+		}
+		if i == len(h.labels)-1 {
+			return true
+		}
+	}
+	if ps != nil {
+		*ps = (*ps)[:mark]
+	}
+	return false
+}
+
+// 找到或者创建pattern对应的hostRoutes，静态的Host排在带参数的Host前面
+func (r *router) hostRoutes(pattern string) *hostRoutes {
+	for _, h := range r.hosts {
+		if h.pattern == pattern {
+			return h
+		}
+	}
+	h := newHostRoutes(pattern)
+	r.hosts = append(r.hosts, h)
+	sort.SliceStable(r.hosts, func(i, j int) bool {
+		return !r.hosts[i].hasWild && r.hosts[j].hasWild
+	})
+	return h
+}
+
+// 根据请求的Host选出路由表，返回nil表示使用不限定Host的路由
+// Host匹配但其中没有任何方法能匹配path时，继续尝试后面的Host，最后退回不限定Host的路由
+// 都不能直接匹配时，再按RedirectFixedPath和CaseInsensitive修正path后在Host中查找一次，这样限定了Host的路由同样会被重定向
+func (r *router) selectHost(host string, path string, config *Config) *hostRoutes {
+	matched := false
+	for _, h := range r.hosts {
+		if !h.match(host, nil) {
+			continue
+		}
+		for method := range h.roots {
+			if search(h.roots, method, path, nil) != nil {
+				return h
+			}
+		}
+		matched = true
+	}
+	if !matched || !config.RedirectFixedPath && !config.CaseInsensitive {
+		return nil
+	}
+	for method := range r.roots {
+		if search(r.roots, method, path, nil) != nil {
+			return nil
+		}
+	}
+	for _, h := range r.hosts {
+		if !h.match(host, nil) {
+			continue
+		}
+		for method := range h.roots {
+			if fixedPath(h.roots, method, path, config) != "" {
+				return h
+			}
+		}
+	}
+	return nil
+}
+
+// Host 返回一个只匹配指定Host的RouterGroup，Host中的参数和路径参数一样放在Context.Params里
+// 同一个Host pattern多次调用共享同一组路由，没有匹配到的请求退回到不限定Host的路由
+// e.g. engine.Host(":tenant.example.com").GET("/", index)
+func (engine *Engine) Host(pattern string) *RouterGroup {
+	newGroup := &RouterGroup{
+		parent: engine.RouterGroup,
+		engine: engine,
+		host:   engine.router.hostRoutes(strings.ToLower(stripPort(pattern))),
+	}
+	engine.groups = append(engine.groups, newGroup)
+	return newGroup
+}
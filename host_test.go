@@ -0,0 +1,74 @@
+package wygo
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHostRoutes(t *testing.T) {
+	engine := New()
+	engine.Config().RedirectFixedPath = true
+	api := engine.Host("api.example.com")
+	api.GET("/users/:id", func(c *Context) {
+		c.String("api user %s", c.Param("id"))
+	})
+	api.POST("/users", writeRoute)
+	engine.Host(":tenant.example.com").GET("/", func(c *Context) {
+		c.String("tenant %s", c.Param("tenant"))
+	})
+	engine.GET("/users/:id", func(c *Context) {
+		c.String("main user %s", c.Param("id"))
+	})
+	engine.GET("/about", func(c *Context) {
+		c.String("main about")
+	})
+
+	tests := []struct {
+		host   string
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"api.example.com", "GET", "/users/1", http.StatusOK, "api user 1"},
+		// 端口和大小写不影响Host的匹配
+		{"API.Example.com:8080", "GET", "/users/1", http.StatusOK, "api user 1"},
+		// 静态的Host优先于带参数的Host
+		{"acme.example.com", "GET", "/", http.StatusOK, "tenant acme"},
+		// Host中的参数只匹配一段
+		{"a.b.example.com", "GET", "/", http.StatusNotFound, ""},
+		// Host中没有这个路径时退回不限定Host的路由
+		{"api.example.com", "GET", "/about", http.StatusOK, "main about"},
+		{"acme.example.com", "GET", "/users/2", http.StatusOK, "main user 2"},
+		{"other.com", "GET", "/users/3", http.StatusOK, "main user 3"},
+		{"other.com", "GET", "/", http.StatusNotFound, ""},
+		// 405的Allow头只包含匹配到的Host中的方法
+		{"api.example.com", "DELETE", "/users", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		w := performRequest(engine, tt.method, tt.host, tt.path)
+		if w.Code != tt.status || tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s %s%s: got %d %q, want %d %q", tt.method, tt.host, tt.path, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+	if w := performRequest(engine, "DELETE", "api.example.com", "/users"); w.Header().Get("Allow") != "OPTIONS, POST" {
+		t.Errorf("DELETE api.example.com/users: Allow = %q, want %q", w.Header().Get("Allow"), "OPTIONS, POST")
+	}
+
+	// 限定了Host的路由同样会被清理路径后重定向
+	redirects := []struct {
+		host     string
+		path     string
+		location string
+	}{
+		{"api.example.com", "/users/../users/1", "/users/1"},
+		{"api.example.com", "//users/1", "/users/1"},
+		{"acme.example.com", "/x/..", "/"},
+	}
+	for _, tt := range redirects {
+		w := performRequest(engine, "GET", tt.host, tt.path)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != tt.location {
+			t.Errorf("GET %s%s: got %d Location=%q, want 301 Location=%q", tt.host, tt.path, w.Code, w.Header().Get("Location"), tt.location)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package wygo
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// GetAs 从Kv中取出key对应的值并转换成T，不存在或者类型不对时返回false
+// 存的是nil并且T是接口、指针等可以为nil的类型时，返回T的零值和true，和Key.Get一致
+// e.g. user, ok := wygo.GetAs[*User](c, "user")
+func GetAs[T any](c *Context, key string) (T, bool) {
+	var zero T
+	value, exists := c.Get(key)
+	if !exists {
+		return zero, false
+	}
+	if value == nil {
+		switch reflect.TypeOf((*T)(nil)).Elem().Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return zero, true
+		}
+		return zero, false
+	}
+	v, ok := value.(T)
+	if !ok {
+		return zero, false
+	}
+	return v, true
+}
+
+// MustGet 同GetAs，不存在或者类型不对时panic
+func MustGet[T any](c *Context, key string) T {
+	v, ok := GetAs[T](c, key)
+	if !ok {
+		panic(fmt.Sprintf("wygo: key %q does not exist or is not a %v", key, reflect.TypeOf((*T)(nil)).Elem()))
+	}
+	return v
+}
+
+// Key 是带类型的键，不同中间件包即使用了相同的名字也不会冲突
+// 存储的值也可以通过Context.Value(key)取到，方便第三方库使用
+// e.g. var UserKey = wygo.NewKey[*User]("user")
+type Key[T any] struct {
+	name string
+}
+
+// NewKey 创建一个新的键，name只用于错误提示
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+func (k *Key[T]) String() string {
+	return k.name
+}
+
+// Set 把value存到c中
+func (k *Key[T]) Set(c *Context, value T) {
+	c.mu.Lock()
+	if c.keys == nil {
+		c.keys = make(map[any]any)
+	}
+	c.keys[k] = value
+	c.mu.Unlock()
+}
+
+// Get 从c中取出值，没有设置过时返回false
+func (k *Key[T]) Get(c *Context) (T, bool) {
+	c.mu.RLock()
+	value, exists := c.keys[k]
+	c.mu.RUnlock()
+	if !exists {
+		var zero T
+		return zero, false
+	}
+	// T是接口类型时，存进来的值可能是nil
+	v, _ := value.(T)
+	return v, true
+}
+
+// MustGet 同Get，没有设置过时panic
+func (k *Key[T]) MustGet(c *Context) T {
+	v, ok := k.Get(c)
+	if !ok {
+		panic(fmt.Sprintf("wygo: key %s is not set", k.name))
+	}
+	return v
+}
@@ -0,0 +1,29 @@
+package wygo
+
+import "testing"
+
+// 存进去的nil也算设置过，GetAs和Key.Get的结果一致
+func TestGetNilValue(t *testing.T) {
+	c := &Context{}
+	c.Set("err", nil)
+	errKey := NewKey[error]("err")
+	errKey.Set(c, nil)
+
+	if v, ok := GetAs[error](c, "err"); v != nil || !ok {
+		t.Errorf("GetAs[error] = %v, %v, want nil, true", v, ok)
+	}
+	if v, ok := errKey.Get(c); v != nil || !ok {
+		t.Errorf("Key[error].Get = %v, %v, want nil, true", v, ok)
+	}
+	if v, ok := GetAs[*Context](c, "err"); v != nil || !ok {
+		t.Errorf("GetAs[*Context] = %v, %v, want nil, true", v, ok)
+	}
+	if v, ok := GetAs[int](c, "err"); v != 0 || ok {
+		t.Errorf("GetAs[int] = %v, %v, want 0, false", v, ok)
+	}
+	if _, ok := GetAs[error](c, "missing"); ok {
+		t.Error("GetAs[error] of a missing key returned true")
+	}
+	MustGet[error](c, "err")
+	errKey.MustGet(c)
+}
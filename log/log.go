@@ -16,7 +16,9 @@ var (
 	errorLog    = log.New(os.Stdout, "\033[31m[error]\033[0m ", log.LstdFlags|log.Lshortfile)
 	loggers     = []*log.Logger{debugLog, infoLog, warningLog, errorLog}
 	loggerLabel = []string{"debug", "info", "warning", "error"}
-	mu          sync.Mutex
+	// LogToFile打开的文件，Close时关闭
+	files []*os.File
+	mu    sync.Mutex
 )
 
 // log methods
@@ -70,8 +72,31 @@ func LogToFile(logFolder string, level int) {
 			if err != nil {
 				log.Fatalf("error writing log to file: %v", err)
 			}
-			//defer f.Close()
+			files = append(files, f)
 			logger.SetOutput(f)
 		}
 	}
 }
+
+// Close flushes and closes the files opened by LogToFile, the loggers write to stdout again
+// it is called when the engine shuts down
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	var firstErr error
+	for _, f := range files {
+		if err := f.Sync(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, logger := range loggers {
+		if logger.Writer() != io.Discard {
+			logger.SetOutput(os.Stdout)
+		}
+	}
+	files = nil
+	return firstErr
+}
@@ -12,9 +12,6 @@ func Logger() wygo.HandlerFunc {
 		//fmt.Println(c.StatusCode)
 		// 先调用里面的，计算的是包含在内的所有的运行时间
 		c.Next()
-		//fmt.Println(c.StatusCode)
-		if c.StatusCode != 0 {
-			log.Infof("[%d] %s in %v", c.StatusCode, c.Req.RequestURI, time.Since(t))
-		}
+		log.Infof("[%d] %s in %v", c.Status(), c.Req.RequestURI, time.Since(t))
 	}
 }
@@ -29,7 +29,10 @@ func Recovery() wygo.HandlerFunc {
 			if err := recover(); err != nil {
 				message := fmt.Sprintf("%s", err)
 				log.Printf("%s\n\n", trace(message))
-				c.SetStatusInternalServerError()
+				// handler已经写出了响应时，状态码无法再修改
+				if !c.Response().Written() {
+					c.SetStatusInternalServerError()
+				}
 			}
 		}()
 		c.Next()
@@ -0,0 +1,205 @@
+package wygo
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+
+	"github.com/enginewang/wygo/log"
+)
+
+const noWritten = -1
+
+// ResponseWriter 在http.ResponseWriter的基础上记录状态码、写入的字节数和header是否已经写出
+// 状态码会延迟到第一次写body（或者请求结束）时才真正写出，之前可以多次修改
+// 底层的writer实现了http.Flusher、http.Hijacker或http.Pusher时，Context.Writer和Response()返回的值也实现对应的接口，
+// 所以 w.(http.Hijacker) 这样的类型断言和直接对底层的writer断言结果一致，例如HTTP/2（包括h2c）的连接不支持Hijack
+type ResponseWriter interface {
+	http.ResponseWriter
+	// Status 返回要写出或者已经写出的状态码，没有设置时为200
+	Status() int
+	// Size 返回已经写入的body字节数，header还没写出时为-1
+	Size() int
+	// Written 判断header是否已经写出
+	Written() bool
+	// WriteHeaderNow 立即写出header
+	WriteHeaderNow()
+	// Unwrap 返回原始的http.ResponseWriter，供http.ResponseController使用
+	Unwrap() http.ResponseWriter
+}
+
+// 底层writer支持的可选接口，作为wrapped的下标
+const (
+	canFlush = 1 << iota
+	canHijack
+	canPush
+)
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+	// HEAD请求由GET的handler处理时丢弃写入的body
+	discardBody bool
+	// 按底层writer支持的接口组合缓存的包装，responseWriter随Context复用，每种组合只创建一次
+	wrapped [canFlush | canHijack | canPush + 1]ResponseWriter
+}
+
+var _ ResponseWriter = &responseWriter{}
+
+// 重置为包装writer，返回和writer实现了相同可选接口的ResponseWriter
+func (w *responseWriter) reset(writer http.ResponseWriter) ResponseWriter {
+	w.ResponseWriter = writer
+	w.status = http.StatusOK
+	w.size = noWritten
+	w.discardBody = false
+	return w.wrap()
+}
+
+func (w *responseWriter) wrap() ResponseWriter {
+	caps := 0
+	if _, ok := w.ResponseWriter.(http.Flusher); ok {
+		caps |= canFlush
+	}
+	if _, ok := w.ResponseWriter.(http.Hijacker); ok {
+		caps |= canHijack
+	}
+	if _, ok := w.ResponseWriter.(http.Pusher); ok {
+		caps |= canPush
+	}
+	if w.wrapped[caps] == nil {
+		w.wrapped[caps] = w.withInterfaces(caps)
+	}
+	return w.wrapped[caps]
+}
+
+func (w *responseWriter) withInterfaces(caps int) ResponseWriter {
+	f, h, p := flusher{w}, hijacker{w}, pusher{w}
+	switch caps {
+	case canFlush:
+		return struct {
+			*responseWriter
+			http.Flusher
+		}{w, f}
+	case canHijack:
+		return struct {
+			*responseWriter
+			http.Hijacker
+		}{w, h}
+	case canPush:
+		return struct {
+			*responseWriter
+			http.Pusher
+		}{w, p}
+	case canFlush | canHijack:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+		}{w, f, h}
+	case canFlush | canPush:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Pusher
+		}{w, f, p}
+	case canHijack | canPush:
+		return struct {
+			*responseWriter
+			http.Hijacker
+			http.Pusher
+		}{w, h, p}
+	case canFlush | canHijack | canPush:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, f, h, p}
+	}
+	return w
+}
+
+// WriteHeader 只记录状态码，header写出之后再修改会打印warning并忽略
+// 1xx的informational状态码（101除外）直接写出，不影响最终的状态码
+func (w *responseWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code <= 0 || code == w.status {
+		return
+	}
+	if w.Written() {
+		log.Warnf("headers were already written, status code %d is ignored, keep %d", code, w.status)
+		return
+	}
+	w.status = code
+}
+
+func (w *responseWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	if w.discardBody {
+		return len(data), nil
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) WriteString(s string) (int, error) {
+	w.WriteHeaderNow()
+	if w.discardBody {
+		return len(s), nil
+	}
+	n, err := w.ResponseWriter.Write([]byte(s))
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.size != noWritten
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// 只有底层的writer支持时，包装类型上才有Flush、Hijack和Push方法
+type flusher struct{ w *responseWriter }
+
+func (f flusher) Flush() {
+	f.w.WriteHeaderNow()
+	f.w.ResponseWriter.(http.Flusher).Flush()
+}
+
+type hijacker struct{ w *responseWriter }
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	// 连接交给调用方之后，不再由wygo写出header
+	if h.w.size < 0 {
+		h.w.size = 0
+	}
+	return h.w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+type pusher struct{ w *responseWriter }
+
+func (p pusher) Push(target string, opts *http.PushOptions) error {
+	return p.w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
@@ -0,0 +1,77 @@
+package wygo
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 实现了Flusher和Hijacker的writer，例如HTTP/1.1的连接
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (w hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+// 实现了Flusher和Pusher的writer，例如HTTP/2的连接
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (w pushRecorder) Push(string, *http.PushOptions) error {
+	return nil
+}
+
+// Writer和Response()实现的可选接口和底层的writer一致
+func TestResponseWriterInterfaces(t *testing.T) {
+	type capabilities struct {
+		flush, hijack, push bool
+	}
+	var got [2]capabilities
+	engine := New()
+	engine.GET("/", func(c *Context) {
+		for i, w := range []http.ResponseWriter{c.Writer, c.Response()} {
+			_, got[i].flush = w.(http.Flusher)
+			_, got[i].hijack = w.(http.Hijacker)
+			_, got[i].push = w.(http.Pusher)
+		}
+		c.String("body")
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		writer func(*httptest.ResponseRecorder) http.ResponseWriter
+		want   capabilities
+	}{
+		{"plain", "GET", func(r *httptest.ResponseRecorder) http.ResponseWriter { return struct{ http.ResponseWriter }{r} }, capabilities{}},
+		{"flusher", "GET", func(r *httptest.ResponseRecorder) http.ResponseWriter { return r }, capabilities{flush: true}},
+		{"http1", "GET", func(r *httptest.ResponseRecorder) http.ResponseWriter { return hijackRecorder{r} }, capabilities{flush: true, hijack: true}},
+		{"http2", "GET", func(r *httptest.ResponseRecorder) http.ResponseWriter { return pushRecorder{r} }, capabilities{flush: true, push: true}},
+		// GET处理的HEAD请求只丢弃body，不影响可选接口
+		{"head", "HEAD", func(r *httptest.ResponseRecorder) http.ResponseWriter { return hijackRecorder{r} }, capabilities{flush: true, hijack: true}},
+	}
+	for _, tt := range tests {
+		// 同一个Context会被复用，依次换成不同的writer
+		for i := 0; i < 2; i++ {
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(tt.writer(rec), httptest.NewRequest(tt.method, "/", nil))
+			for j, name := range []string{"Writer", "Response()"} {
+				if got[j] != tt.want {
+					t.Errorf("%s: %s implements %+v, want %+v", tt.name, name, got[j], tt.want)
+				}
+			}
+			wantBody := "body"
+			if tt.method == "HEAD" {
+				wantBody = ""
+			}
+			if rec.Code != http.StatusOK || rec.Body.String() != wantBody {
+				t.Errorf("%s: got %d %q, want 200 %q", tt.name, rec.Code, rec.Body.String(), wantBody)
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package wygo
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Route 是一条注册好的路由，由RouterGroup.GET等方法返回
+type Route struct {
+	Method   string
+	Pattern  string // 包含group前缀的完整pattern
+	name     string
+	handlers []HandlerFunc // group中间件 + 路由中间件 + handler，注册时计算好
+	// 解析好的路径段，生成URL时不用再解析pattern和编译约束中的正则
+	segments []routeSegment
+	// 只作用于这个路由的中间件
+	middlewares []HandlerFunc
+	group       *RouterGroup
+	engine      *Engine
+}
+
+// RouteInfo 描述一条路由，由Engine.Routes返回
+type RouteInfo struct {
+	Host        string // 通过Engine.Host注册时为Host pattern，否则为空
+	Method      string
+	Pattern     string
+	Name        string
+	Handler     string   // handler的函数名
+	Middlewares []string // 会在handler之前执行的中间件（包括group的和路由自己的）的函数名，按执行顺序
+	HandlerFunc HandlerFunc
+}
+
+// Routes 按注册顺序返回所有路由，可以用来生成文档或者检查某个路由是否缺少中间件
+func (engine *Engine) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0, len(engine.routes))
+	for _, r := range engine.routes {
+		last := len(r.handlers) - 1
+		middlewares := make([]string, 0, last)
+		for _, m := range r.handlers[:last] {
+			middlewares = append(middlewares, getFuncName(m))
+		}
+		host := ""
+		if r.group.host != nil {
+			host = r.group.host.pattern
+		}
+		routes = append(routes, RouteInfo{
+			Host:        host,
+			Method:      r.Method,
+			Pattern:     r.Pattern,
+			Name:        r.name,
+			Handler:     getFuncName(r.handlers[last]),
+			Middlewares: middlewares,
+			HandlerFunc: r.handlers[last],
+		})
+	}
+	return routes
+}
+
+// PrintRoutes 以对齐的表格打印所有路由
+func (engine *Engine) PrintRoutes() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATTERN\tNAME\tHANDLER\tMIDDLEWARES")
+	for _, r := range engine.Routes() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Method, r.Host+r.Pattern, r.Name, r.Handler, strings.Join(r.Middlewares, "<->"))
+	}
+	w.Flush()
+}
+
+// Name 给路由命名，之后可以用Engine.URL或者模板中的urlFor反向生成路径
+// e.g. r.GET("/user/:id", show).Name("user.show")
+func (r *Route) Name(name string) *Route {
+	if old, ok := r.engine.namedRoutes[name]; ok {
+		panic(fmt.Sprintf("wygo: route name %s is already used by %s %s", name, old.Method, old.Pattern))
+	}
+	r.name = name
+	r.engine.namedRoutes[name] = r
+	return r
+}
+
+// GetName returns the name of the route, empty if it is not named
+func (r *Route) GetName() string {
+	return r.name
+}
+
+// URL 按路由名生成路径，params按顺序填入pattern中的 :param 和 *catchall
+// 参数值会做转义，*catchall中的/会保留；参数个数不对或者不满足约束时返回error
+// e.g. engine.URL("user.show", 42) => /user/42
+func (engine *Engine) URL(name string, params ...interface{}) (string, error) {
+	r, ok := engine.namedRoutes[name]
+	if !ok {
+		return "", fmt.Errorf("wygo: no route named %s", name)
+	}
+	return r.URL(params...)
+}
+
+// pattern中的一个路径段
+type routeSegment struct {
+	text  string // 静态段的内容
+	wild  byte   // 参数为:，通配为*，静态段为0
+	key   string
+	check paramConstraint
+}
+
+// 注册路由时解析一次pattern
+func parseRouteSegments(pattern string) []routeSegment {
+	parts := parsePattern(pattern)
+	segments := make([]routeSegment, len(parts))
+	for i, part := range parts {
+		if part[0] != ':' && part[0] != '*' {
+			segments[i] = routeSegment{text: part}
+			continue
+		}
+		key, _, check := parseParamToken(part)
+		segments[i] = routeSegment{wild: part[0], key: key, check: check}
+	}
+	return segments
+}
+
+// URL 用params填充这条路由的pattern，规则同Engine.URL
+func (r *Route) URL(params ...interface{}) (string, error) {
+	var sb strings.Builder
+	i := 0
+	for _, seg := range r.segments {
+		sb.WriteByte('/')
+		if seg.wild == 0 {
+			sb.WriteString(seg.text)
+			continue
+		}
+		if i >= len(params) {
+			return "", fmt.Errorf("wygo: not enough params for route %s", r.Pattern)
+		}
+		value := fmt.Sprint(params[i])
+		i++
+		if seg.wild == '*' {
+			segments := strings.Split(value, "/")
+			for j, segment := range segments {
+				segments[j] = url.PathEscape(segment)
+			}
+			sb.WriteString(strings.Join(segments, "/"))
+			continue
+		}
+		if value == "" || seg.check != nil && !seg.check(value) {
+			return "", fmt.Errorf("wygo: invalid value %q for param %s in route %s", value, seg.key, r.Pattern)
+		}
+		sb.WriteString(url.PathEscape(value))
+	}
+	if i != len(params) {
+		return "", fmt.Errorf("wygo: too many params for route %s", r.Pattern)
+	}
+	// 保留注册时末尾的/，否则生成的链接会被RedirectTrailingSlash重定向
+	if sb.Len() == 0 || strings.HasSuffix(r.Pattern, "/") {
+		sb.WriteByte('/')
+	}
+	return sb.String(), nil
+}
@@ -1,20 +1,31 @@
 package wygo
 
 import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
 	"strings"
+	"sync"
 )
 
 type router struct {
-	roots    map[string]*node
-	handlers map[string]HandlerFunc
+	// 对于每种类型的方法，存各个方法的radix tree根节点，handler直接存在节点上
+	roots map[string]*node
+	// 限定了Host的路由，每个Host pattern有自己的一组根节点
+	hosts []*hostRoutes
+	// 复用查找时收集路径参数的切片，静态路由的查找不分配内存
+	paramsPool sync.Pool
 }
 
 func newRouter() *router {
 	return &router{
-		// 对于每种类型的方法，存各个方法的node根节点
 		roots: make(map[string]*node),
-		// 对于各个具体的pattern，存对应的handlerFunc
-		handlers: make(map[string]HandlerFunc),
+		paramsPool: sync.Pool{New: func() any {
+			ps := make(routeParams, 0, 8)
+			return &ps
+		}},
 	}
 }
 
@@ -34,60 +45,274 @@ func parsePattern(pattern string) []string {
 	return parts
 }
 
-// 添加一个router
-func (r *router) addRoute(method string, pattern string, handler HandlerFunc) {
-	parts := parsePattern(pattern)
-	key := method + "-" + pattern
-	_, ok := r.roots[method]
+// 将请求路径规范成和树里一致的形式：以/开头、没有空的路径段、末尾没有/
+// 已经是规范形式的路径直接返回，不分配内存
+func normalizePath(path string) string {
+	if len(path) > 0 && path[0] == '/' && !strings.Contains(path, "//") &&
+		(len(path) == 1 || path[len(path)-1] != '/') {
+		return path
+	}
+	parts := make([]string, 0)
+	for _, item := range strings.Split(path, "/") {
+		if item != "" {
+			parts = append(parts, item)
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// 清理路径中的 .、.. 和重复的/，保留末尾的/
+func cleanPath(p string) string {
+	if p == "" || p[0] != '/' {
+		p = "/" + p
+	}
+	cleaned := path.Clean(p)
+	if p[len(p)-1] == '/' && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// 返回匹配到路由n的请求路径p的规范形式：没有空的路径段，末尾是否有/和注册时的pattern一致
+// *catchall路由保留请求末尾的/；p已经是规范形式时原样返回，不分配内存
+func canonicalPath(n *node, p string) string {
+	norm := normalizePath(p)
+	trailing := strings.HasSuffix(n.pattern, "/")
+	if n.typ == catchAll {
+		trailing = strings.HasSuffix(p, "/")
+	}
+	if !trailing || norm == "/" {
+		return norm
+	}
+	if len(p) == len(norm)+1 && p[len(p)-1] == '/' && strings.HasPrefix(p, norm) {
+		return p
+	}
+	return norm + "/"
+}
+
+// 添加一个router，重复注册或者和已有路由冲突时会panic
+// handlers是包含group中间件在内的完整调用链，host不为nil时路由只匹配对应的Host
+func (r *router) addRoute(host *hostRoutes, method string, pattern string, handlers []HandlerFunc) {
+	roots := r.roots
+	if host != nil {
+		roots = host.roots
+	}
+	_, ok := roots[method]
 	if !ok {
-		r.roots[method] = &node{}
+		roots[method] = &node{}
 	}
-	// 往对应方法的Trie中插入一个节点
-	r.roots[method].insert(pattern, parts, 0)
-	// 另外存一下handler
-	r.handlers[key] = handler
+	// 往对应方法的树中插入，pattern和handler存在结束处的节点上
+	n := roots[method].insert(pattern)
+	if n.pattern == pattern {
+		panic(fmt.Sprintf("wygo: route %s %s is already registered", method, pattern))
+	}
+	if n.pattern != "" {
+		panic(fmt.Sprintf("wygo: route %s conflicts with existing route %s", pattern, n.pattern))
+	}
+	n.pattern = pattern
+	n.handlers = handlers
 }
 
-// 获取router，返回对应的node和param map
-func (r *router) getRoute(method string, path string) (*node, map[string]string) {
-	searchParts := parsePattern(path)
-	params := make(map[string]string)
-	root, ok := r.roots[method]
+// 在roots中method对应的树中查找path，ps不为nil时会把路径参数追加到ps中
+func search(roots map[string]*node, method string, path string, ps *routeParams) *node {
+	root, ok := roots[method]
 	if !ok {
+		return nil
+	}
+	return root.search(normalizePath(path), ps)
+}
+
+// 获取router，返回对应的node和param map，Host中的参数也会放在map里
+// 没有参数时返回的map为nil，静态路由的查找不分配内存
+func (r *router) getRoute(host *hostRoutes, hostname string, method string, path string) (*node, map[string]string) {
+	ps := r.paramsPool.Get().(*routeParams)
+	*ps = (*ps)[:0]
+	defer r.paramsPool.Put(ps)
+	roots := r.roots
+	if host != nil {
+		roots = host.roots
+		host.match(hostname, ps)
+	}
+	n := search(roots, method, path, ps)
+	if n == nil {
 		return nil, nil
 	}
-	// 先搜索匹配这个parts的的所有node
-	n := root.search(searchParts, 0)
-	// 如果搜索到了
-	if n != nil {
-		// 解析这个pattern字符串
-		parts := parsePattern(n.pattern)
-		for index, part := range parts {
-			// 如果part开头是:，就将搜索到的子节点作为对应的param进行存储
-			if part[0] == ':' {
-				params[part[1:]] = searchParts[index]
-			}
-			// 如果是*的话，就将剩下的都作为param
-			if part[0] == '*' && len(part) > 1 {
-				params[part[1:]] = strings.Join(searchParts[index:], "/")
-				break
-			}
+	var params map[string]string
+	if len(*ps) > 0 {
+		params = make(map[string]string, len(*ps))
+		for _, p := range *ps {
+			params[p.key] = p.value
+		}
+	}
+	return n, params
+}
+
+// 找出能够匹配path的所有方法，按字母序返回
+// 开启了自动HEAD和OPTIONS时，也会把它们算进去
+func allowedMethods(roots map[string]*node, path string, config *Config) []string {
+	allowed := make([]string, 0)
+	hasGet, hasHead, hasOptions := false, false, false
+	for m := range roots {
+		if m == methodAny {
+			continue
+		}
+		if n := search(roots, m, path, nil); n != nil {
+			allowed = append(allowed, m)
+			hasGet = hasGet || m == http.MethodGet
+			hasHead = hasHead || m == http.MethodHead
+			hasOptions = hasOptions || m == http.MethodOptions
 		}
-		return n, params
 	}
-	return nil, nil
+	if len(allowed) == 0 {
+		return allowed
+	}
+	if config.HandleHEAD && hasGet && !hasHead {
+		allowed = append(allowed, http.MethodHead)
+	}
+	if config.HandleOPTIONS && !hasOptions {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	sort.Strings(allowed)
+	return allowed
 }
 
+// 匹配到的路由直接使用注册时计算好的调用链
+// 405、404和OPTIONS的处理函数追加在路径所在group的中间件之后，所以未命中的请求同样会经过日志、鉴权等中间件
 func (r *router) handle(c *Context) {
-	n, params := r.getRoute(c.Method, c.Path)
+	config := c.engine.config
+	method := c.Method
+	host := r.selectHost(c.Req.Host, c.Path, config)
+	roots := r.roots
+	if host != nil {
+		roots = host.roots
+	}
+	n, params := r.getRoute(host, c.Req.Host, method, c.Path)
+	// 没有注册HEAD时，交给GET的handler处理，并丢弃写入的body
+	if n == nil && method == http.MethodHead && config.HandleHEAD {
+		if n, params = r.getRoute(host, c.Req.Host, http.MethodGet, c.Path); n != nil {
+			c.writer.discardBody = true
+		}
+	}
+	// 最后交给Mount注册的匹配任意方法的路由
+	mounted := false
+	if n == nil {
+		n, params = r.getRoute(host, c.Req.Host, methodAny, c.Path)
+		mounted = n != nil
+	}
 	if n != nil {
+		// 含有 . 或 .. 的路径可能被:param或*catchall匹配上，同样要先清理再重定向，不能交给handler
+		if config.RedirectFixedPath && cleanPath(c.Path) != c.Path {
+			target := fixedPath(roots, method, c.Path, config)
+			if target == "" {
+				target = cleanPath(c.Path)
+			}
+			r.redirect(c, target)
+			return
+		}
+		// 路径能匹配但不是规范形式时，按配置重定向到规范的路径
+		if target := canonicalPath(n, c.Path); target != c.Path {
+			// Mount的prefix末尾有没有/都直接交给挂载的handler
+			onlySlash := strings.TrimSuffix(target, "/") == strings.TrimSuffix(c.Path, "/")
+			if onlySlash && config.RedirectTrailingSlash && !mounted || !onlySlash && config.RedirectFixedPath {
+				r.redirect(c, target)
+				return
+			}
+		}
 		c.Params = params
-		key := c.Method + "-" + n.pattern
-		c.handlers = append(c.handlers, r.handlers[key])
-	} else {
-		c.handlers = append(c.handlers, func(c *Context) {
-			c.SetStatusInternalServerError().String("404 NOT FOUND: %s\n", c.Path)
-		})
+		c.handlers = n.handlers
+		c.Next()
+		return
 	}
+	if target := fixedPath(roots, c.Method, c.Path, config); target != "" {
+		r.redirect(c, target)
+		return
+	}
+	c.handlers = c.engine.groupMiddlewares(c.Req.Host, c.Path)
+	// 没有注册OPTIONS时，返回这个路径注册过的所有方法
+	if method == http.MethodOptions && config.HandleOPTIONS {
+		if allowed := allowedMethods(roots, c.Path, config); len(allowed) > 0 {
+			c.Writer.Header().Set("Allow", strings.Join(allowed, ", "))
+			c.handlers = append(c.handlers, defaultOptions)
+			c.Next()
+			return
+		}
+	}
+	// 当前方法没有匹配，但其他方法能匹配上，返回405并设置Allow头
+	if config.HandleMethodNotAllowed {
+		if allowed := allowedMethods(roots, c.Path, config); len(allowed) > 0 {
+			c.Writer.Header().Set("Allow", strings.Join(allowed, ", "))
+			c.handlers = append(c.handlers, c.engine.noMethod...)
+			c.Next()
+			return
+		}
+	}
+	c.handlers = append(c.handlers, c.engine.noRoute...)
 	c.Next()
 }
+
+// 没有匹配到路由时，清理路径中的 . 和 ..，或者忽略大小写后再查找一次
+// 找到时返回注册时的规范路径，找不到或者没有开启对应的配置时返回空字符串
+func fixedPath(roots map[string]*node, method string, p string, config *Config) string {
+	if !config.RedirectFixedPath && !config.CaseInsensitive {
+		return ""
+	}
+	methods := []string{method}
+	if method == http.MethodHead && config.HandleHEAD {
+		methods = append(methods, http.MethodGet)
+	}
+	methods = append(methods, methodAny)
+	if config.RedirectFixedPath {
+		p = cleanPath(p)
+	}
+	norm := normalizePath(p)
+	for _, m := range methods {
+		root, ok := roots[m]
+		if !ok {
+			continue
+		}
+		if n := root.search(norm, nil); n != nil {
+			return canonicalPath(n, p)
+		}
+		if !config.CaseInsensitive {
+			continue
+		}
+		if n, fixed := root.searchFold(norm, make([]byte, 0, len(norm))); n != nil {
+			if strings.HasSuffix(p, "/") {
+				fixed = append(fixed, '/')
+			}
+			return canonicalPath(n, string(fixed))
+		}
+	}
+	return ""
+}
+
+// 重定向到target，GET和HEAD用301，其他方法用308以保留方法和body
+// 和404一样会经过路径所在group的中间件
+func (r *router) redirect(c *Context, target string) {
+	code := http.StatusPermanentRedirect
+	if c.Method == http.MethodGet || c.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	u := url.URL{Path: target, RawQuery: c.Req.URL.RawQuery}
+	location := u.String()
+	c.handlers = append(c.engine.groupMiddlewares(c.Req.Host, c.Path), func(c *Context) {
+		c.StatusCode = code
+		http.Redirect(c.Writer, c.Req, location, code)
+	})
+	c.Next()
+}
+
+// 默认的OPTIONS处理函数，Allow头已经设置好了
+func defaultOptions(c *Context) {
+	c.SetStatusCode(http.StatusNoContent)
+}
+
+// 默认的404处理函数
+func defaultNoRoute(c *Context) {
+	c.SetStatusCode(http.StatusNotFound).String("404 NOT FOUND: %s\n", c.Path)
+}
+
+// 默认的405处理函数
+func defaultNoMethod(c *Context) {
+	c.SetStatusCode(http.StatusMethodNotAllowed).String("405 METHOD NOT ALLOWED: %s %s\n", c.Method, c.Path)
+}
@@ -0,0 +1,186 @@
+package wygo
+
+import (
+	"strings"
+	"testing"
+)
+
+var benchRoutes = []string{
+	"/",
+	"/user/new",
+	"/user/list",
+	"/user/:id",
+	"/user/:id/profile",
+	"/user/:id/posts/:post",
+	"/post/archive/latest",
+	"/post/:slug",
+	"/static/*filepath",
+	"/api/v1/users",
+	"/api/v1/users/:id",
+	"/api/v1/orders/:id/items",
+}
+
+func newBenchRouter() *router {
+	r := newRouter()
+	for _, pattern := range benchRoutes {
+		r.addRoute(nil, "GET", pattern, nil)
+	}
+	return r
+}
+
+// 静态路由的查找不能分配内存
+func TestStaticLookupAllocs(t *testing.T) {
+	r := newBenchRouter()
+	allocs := testing.AllocsPerRun(100, func() {
+		r.getRoute(nil, "", "GET", "/api/v1/users")
+	})
+	if allocs != 0 {
+		t.Fatalf("static lookup allocated %v times, want 0", allocs)
+	}
+}
+
+func benchmarkLookup(b *testing.B, path string) {
+	b.Run("radix", func(b *testing.B) {
+		r := newBenchRouter()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if n, _ := r.getRoute(nil, "", "GET", path); n == nil {
+				b.Fatalf("no route for %s", path)
+			}
+		}
+	})
+	b.Run("segment", func(b *testing.B) {
+		r := newSegmentRouter()
+		for _, pattern := range benchRoutes {
+			r.addRoute("GET", pattern)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if n, _ := r.getRoute("GET", path); n == nil {
+				b.Fatalf("no route for %s", path)
+			}
+		}
+	})
+}
+
+func BenchmarkLookupStatic(b *testing.B) {
+	benchmarkLookup(b, "/api/v1/users")
+}
+
+func BenchmarkLookupParam(b *testing.B) {
+	benchmarkLookup(b, "/user/42/posts/7")
+}
+
+func BenchmarkLookupCatchAll(b *testing.B) {
+	benchmarkLookup(b, "/static/css/site/main.css")
+}
+
+// 以下是换成radix tree之前按路径段匹配的trie，只用于对比
+type segmentNode struct {
+	pattern  string
+	part     string
+	children []*segmentNode
+	isWild   bool
+}
+
+func (n *segmentNode) matchChild(part string) *segmentNode {
+	for _, child := range n.children {
+		if child.part == part {
+			return child
+		}
+	}
+	return nil
+}
+
+func (n *segmentNode) matchChildren(part string) []*segmentNode {
+	nodes := make([]*segmentNode, 0)
+	var param, catchAll *segmentNode
+	for _, child := range n.children {
+		switch {
+		case !child.isWild:
+			if child.part == part {
+				nodes = append(nodes, child)
+			}
+		case child.part[0] == ':':
+			param = child
+		default:
+			catchAll = child
+		}
+	}
+	if param != nil {
+		nodes = append(nodes, param)
+	}
+	if catchAll != nil {
+		nodes = append(nodes, catchAll)
+	}
+	return nodes
+}
+
+func (n *segmentNode) insert(pattern string, parts []string, height int) {
+	if len(parts) == height {
+		n.pattern = pattern
+		return
+	}
+	part := parts[height]
+	child := n.matchChild(part)
+	if child == nil {
+		child = &segmentNode{part: part, isWild: part[0] == ':' || part[0] == '*'}
+		n.children = append(n.children, child)
+	}
+	child.insert(pattern, parts, height+1)
+}
+
+func (n *segmentNode) search(parts []string, height int) *segmentNode {
+	if len(parts) == height || strings.HasPrefix(n.part, "*") {
+		if n.pattern == "" {
+			return nil
+		}
+		return n
+	}
+	for _, child := range n.matchChildren(parts[height]) {
+		if result := child.search(parts, height+1); result != nil {
+			return result
+		}
+	}
+	return nil
+}
+
+type segmentRouter struct {
+	roots map[string]*segmentNode
+}
+
+func newSegmentRouter() *segmentRouter {
+	return &segmentRouter{roots: make(map[string]*segmentNode)}
+}
+
+func (r *segmentRouter) addRoute(method string, pattern string) {
+	if _, ok := r.roots[method]; !ok {
+		r.roots[method] = &segmentNode{}
+	}
+	r.roots[method].insert(pattern, parsePattern(pattern), 0)
+}
+
+func (r *segmentRouter) getRoute(method string, path string) (*segmentNode, map[string]string) {
+	searchParts := parsePattern(path)
+	params := make(map[string]string)
+	root, ok := r.roots[method]
+	if !ok {
+		return nil, nil
+	}
+	n := root.search(searchParts, 0)
+	if n == nil {
+		return nil, nil
+	}
+	for index, part := range parsePattern(n.pattern) {
+		if part[0] == ':' {
+			params[part[1:]] = searchParts[index]
+		}
+		if part[0] == '*' && len(part) > 1 {
+			params[part[1:]] = strings.Join(searchParts[index:], "/")
+			break
+		}
+	}
+	return n, params
+}
@@ -0,0 +1,190 @@
+package wygo
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 用httptest执行一个请求，host不为空时设置请求的Host
+func performRequest(engine *Engine, method string, host string, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if host != "" {
+		req.Host = host
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func writeRoute(c *Context) {
+	c.String("%s %s", c.Method, c.Path)
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	engine := New()
+	engine.GET("/users", writeRoute)
+	engine.POST("/users", writeRoute)
+	engine.GET("/users/:id", writeRoute)
+	engine.DELETE("/users/:id", writeRoute)
+	engine.PUT("/items", writeRoute)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{"GET", "/users", http.StatusOK, ""},
+		{"PUT", "/users", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS, POST"},
+		{"PATCH", "/users/42", http.StatusMethodNotAllowed, "DELETE, GET, HEAD, OPTIONS"},
+		{"POST", "/items", http.StatusMethodNotAllowed, "OPTIONS, PUT"},
+		{"DELETE", "/nope", http.StatusNotFound, ""},
+		{"PUT", "/users/42/posts", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := performRequest(engine, tt.method, "", tt.path)
+		if w.Code != tt.status || w.Header().Get("Allow") != tt.allow {
+			t.Errorf("%s %s: got %d Allow=%q, want %d Allow=%q", tt.method, tt.path, w.Code, w.Header().Get("Allow"), tt.status, tt.allow)
+		}
+	}
+
+	// 关闭后按404处理
+	engine.Config().HandleMethodNotAllowed = false
+	if w := performRequest(engine, "PUT", "", "/users"); w.Code != http.StatusNotFound || w.Header().Get("Allow") != "" {
+		t.Errorf("PUT /users with HandleMethodNotAllowed off: got %d Allow=%q, want 404", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestAutoHeadAndOptions(t *testing.T) {
+	engine := New()
+	engine.GET("/users", func(c *Context) {
+		c.SetHeader("X-Route", "get")
+		c.String("users")
+	})
+	engine.POST("/users", writeRoute)
+	engine.GET("/files", writeRoute)
+	engine.HEAD("/files", func(c *Context) {
+		c.SetHeader("X-Route", "head")
+	})
+	engine.OPTIONS("/files", func(c *Context) {
+		c.SetHeader("X-Route", "options")
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		route  string
+		allow  string
+	}{
+		// 没有注册HEAD时由GET处理，丢弃body但保留header
+		{"HEAD", "/users", http.StatusOK, "get", ""},
+		// 单独注册的HEAD和OPTIONS优先
+		{"HEAD", "/files", http.StatusOK, "head", ""},
+		{"OPTIONS", "/files", http.StatusOK, "options", ""},
+		{"OPTIONS", "/users", http.StatusNoContent, "", "GET, HEAD, OPTIONS, POST"},
+		{"OPTIONS", "/nope", http.StatusNotFound, "", ""},
+		{"HEAD", "/nope", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		w := performRequest(engine, tt.method, "", tt.path)
+		if w.Code != tt.status || w.Header().Get("X-Route") != tt.route || w.Header().Get("Allow") != tt.allow {
+			t.Errorf("%s %s: got %d X-Route=%q Allow=%q, want %d X-Route=%q Allow=%q", tt.method, tt.path,
+				w.Code, w.Header().Get("X-Route"), w.Header().Get("Allow"), tt.status, tt.route, tt.allow)
+		}
+		if tt.method == "HEAD" && tt.status == http.StatusOK && w.Body.Len() != 0 {
+			t.Errorf("%s %s: body = %q, want empty", tt.method, tt.path, w.Body.String())
+		}
+	}
+
+	// 关闭后HEAD和OPTIONS和其他没有注册的方法一样返回405
+	engine.Config().HandleHEAD = false
+	engine.Config().HandleOPTIONS = false
+	for _, method := range []string{"HEAD", "OPTIONS"} {
+		w := performRequest(engine, method, "", "/users")
+		if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, POST" {
+			t.Errorf("%s /users when disabled: got %d Allow=%q, want 405 Allow=%q", method, w.Code, w.Header().Get("Allow"), "GET, POST")
+		}
+	}
+}
+
+func TestRouteConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes [][2]string // 按顺序注册的 method 和 pattern
+		panic  string      // 最后一个路由注册时panic信息中应该包含的内容，为空时不应该panic
+	}{
+		{"duplicate", [][2]string{{"GET", "/users"}, {"GET", "/users"}}, "GET /users is already registered"},
+		{"duplicate param", [][2]string{{"GET", "/users/:id"}, {"GET", "/users/:id"}}, "is already registered"},
+		{"duplicate ignoring slashes", [][2]string{{"GET", "/users/"}, {"GET", "/users"}}, "conflicts with existing route /users/"},
+		{"param name", [][2]string{{"GET", "/users/:id"}, {"GET", "/users/:name/posts"}}, "wildcard :name in route /users/:name/posts conflicts with :id"},
+		{"catch-all name", [][2]string{{"GET", "/static/*filepath"}, {"GET", "/static/*path"}}, "wildcard *path in route /static/*path conflicts with *filepath"},
+		{"unclosed constraint", [][2]string{{"GET", `/ratio/:d<\d+/\d+>`}}, "unclosed constraint in :d<\\d+"},
+		{"other method", [][2]string{{"GET", "/users"}, {"POST", "/users"}}, ""},
+		{"static and param", [][2]string{{"GET", "/users/:id"}, {"GET", "/users/new"}}, ""},
+		{"param and catch-all", [][2]string{{"GET", "/users/:id"}, {"GET", "/users/*rest"}}, ""},
+	}
+	for _, tt := range tests {
+		engine := New()
+		last := len(tt.routes) - 1
+		for _, route := range tt.routes[:last] {
+			engine.addRoute(route[0], route[1], []HandlerFunc{writeRoute})
+		}
+		got := func() (msg string) {
+			defer func() {
+				if r := recover(); r != nil {
+					msg = fmt.Sprint(r)
+				}
+			}()
+			engine.addRoute(tt.routes[last][0], tt.routes[last][1], []HandlerFunc{writeRoute})
+			return ""
+		}()
+		if tt.panic == "" && got != "" || !strings.Contains(got, tt.panic) {
+			t.Errorf("%s: panic = %q, want %q", tt.name, got, tt.panic)
+		}
+	}
+}
+
+func TestRedirectFixedPath(t *testing.T) {
+	engine := New()
+	engine.Config().RedirectFixedPath = true
+	engine.GET("/users", writeRoute)
+	engine.POST("/users", writeRoute)
+	engine.GET("/user/:id", writeRoute)
+	engine.GET("/files/*path", writeRoute)
+	engine.GET("/docs/", writeRoute)
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{"GET", "/users", http.StatusOK, ""},
+		{"GET", "/user/42", http.StatusOK, ""},
+		{"GET", "/files/a/b.txt", http.StatusOK, ""},
+		{"GET", "/files/a..b", http.StatusOK, ""},
+		// 能被:id或*path匹配的 . 和 .. 也要清理，不能交给handler
+		{"GET", "/user/..", http.StatusMovedPermanently, "/"},
+		{"GET", "/user/.", http.StatusMovedPermanently, "/user"},
+		{"GET", "/user/42/../7", http.StatusMovedPermanently, "/user/7"},
+		{"GET", "/files/../users", http.StatusMovedPermanently, "/users"},
+		{"GET", "/files/a/./b.txt", http.StatusMovedPermanently, "/files/a/b.txt"},
+		{"GET", "/files/a/../../user/42", http.StatusMovedPermanently, "/user/42"},
+		{"POST", "/files/../users", http.StatusPermanentRedirect, "/users"},
+		// 清理后按注册时的形式补上或者去掉末尾的/
+		{"GET", "/docs/../docs", http.StatusMovedPermanently, "/docs/"},
+		{"GET", "//users", http.StatusMovedPermanently, "/users"},
+		{"GET", "/users/", http.StatusMovedPermanently, "/users"},
+		{"GET", "/nope/../nothing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := performRequest(engine, tt.method, "", tt.path)
+		if w.Code != tt.status || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s %s: got %d Location=%q, want %d Location=%q", tt.method, tt.path, w.Code, w.Header().Get("Location"), tt.status, tt.location)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package wygo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/enginewang/wygo/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// OnShutdown 注册在server关闭、请求处理完之后执行的函数，例如关闭数据库连接池
+// 按注册顺序执行，最后会关闭log包打开的日志文件
+func (engine *Engine) OnShutdown(hooks ...func()) {
+	engine.serverMu.Lock()
+	defer engine.serverMu.Unlock()
+	engine.onShutdown = append(engine.onShutdown, hooks...)
+}
+
+// 启动时打印中间件和路由表
+func (engine *Engine) printStartup(addr string) {
+	for _, group := range engine.groups {
+		if group.prefix != "" {
+			group.PrintMiddlewares()
+		}
+	}
+	engine.PrintRoutes()
+	fmt.Printf("Wygo Serve on %v\n", addr)
+}
+
+// RunWithContext 启动http server，ctx结束时优雅关闭：不再接受新连接，
+// 等待正在处理的请求完成（最多等待Config.ShutdownTimeout），然后执行OnShutdown注册的函数
+// 正常关闭时返回nil
+func (engine *Engine) RunWithContext(ctx context.Context, addr string) error {
+	engine.printStartup(addr)
+	server := engine.newServer(addr)
+	return engine.serve(ctx, server, server.ListenAndServe)
+}
+
+// RunTLS 启动https server，证书可以是自签名的
+func (engine *Engine) RunTLS(addr string, certFile string, keyFile string) error {
+	engine.printStartup(addr)
+	server := engine.newServer(addr)
+	return engine.serve(context.Background(), server, func() error {
+		return server.ListenAndServeTLS(certFile, keyFile)
+	})
+}
+
+// RunListener 在已有的listener上启动server
+func (engine *Engine) RunListener(listener net.Listener) error {
+	engine.printStartup(listener.Addr().String())
+	server := engine.newServer(listener.Addr().String())
+	return engine.serve(context.Background(), server, func() error {
+		return server.Serve(listener)
+	})
+}
+
+// RunUnix 在unix socket上启动server，例如放在nginx后面
+// 启动前会删除已经存在的socket文件，server关闭后也会删除；socketPath是其他类型的文件时返回error
+func (engine *Engine) RunUnix(socketPath string) error {
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("wygo: %s exists and is not a unix socket", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socketPath)
+	return engine.RunListener(listener)
+}
+
+// RunH2C 以HTTP/2 cleartext（h2c）模式启动server，不需要TLS，同时仍然支持HTTP/1.1
+// 等同于设置Config.H2C后调用Run
+func (engine *Engine) RunH2C(addr string) error {
+	engine.config.H2C = true
+	return engine.Run(addr)
+}
+
+// 按Config中的超时和header大小限制创建http.Server，开启H2C时用h2c包装handler
+func (engine *Engine) newServer(addr string) *http.Server {
+	var handler http.Handler = engine
+	if engine.config.H2C {
+		handler = h2c.NewHandler(engine, &http2.Server{IdleTimeout: engine.config.IdleTimeout})
+	}
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       engine.config.ReadTimeout,
+		ReadHeaderTimeout: engine.config.ReadHeaderTimeout,
+		WriteTimeout:      engine.config.WriteTimeout,
+		IdleTimeout:       engine.config.IdleTimeout,
+		MaxHeaderBytes:    engine.config.MaxHeaderBytes,
+	}
+}
+
+// 运行server，直到serve返回错误、ctx结束、收到退出信号或者调用了Shutdown
+func (engine *Engine) serve(ctx context.Context, server *http.Server, serve func() error) error {
+	done := make(chan struct{})
+	engine.serverMu.Lock()
+	if engine.server != nil {
+		engine.serverMu.Unlock()
+		return errors.New("wygo: engine is already running")
+	}
+	engine.server = server
+	engine.shutdownDone = done
+	engine.serverMu.Unlock()
+
+	if engine.config.HandleSignals {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serve()
+	}()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			// 启动失败，清理掉server，允许再次启动
+			engine.serverMu.Lock()
+			engine.server = nil
+			engine.serverMu.Unlock()
+			return err
+		}
+		// 其他地方调用了Shutdown，等它处理完
+		<-done
+		return nil
+	case <-ctx.Done():
+		log.Info("Wygo shutting down")
+		shutdownCtx := context.Background()
+		if engine.config.ShutdownTimeout > 0 {
+			var cancel context.CancelFunc
+			shutdownCtx, cancel = context.WithTimeout(shutdownCtx, engine.config.ShutdownTimeout)
+			defer cancel()
+		}
+		return engine.Shutdown(shutdownCtx)
+	}
+}
+
+// Shutdown 优雅关闭正在运行的server，等待正在处理的请求完成，直到ctx结束
+// ctx先结束时强制关闭剩下的连接，并返回ctx的错误
+// 之后依次执行OnShutdown注册的函数，并关闭日志文件；server没有运行时直接返回nil
+func (engine *Engine) Shutdown(ctx context.Context) error {
+	engine.serverMu.Lock()
+	server, done, hooks := engine.server, engine.shutdownDone, engine.onShutdown
+	engine.server, engine.shutdownDone = nil, nil
+	engine.serverMu.Unlock()
+	if server == nil {
+		return nil
+	}
+	err := server.Shutdown(ctx)
+	if err != nil {
+		// 还有没处理完的请求，先断开它们的连接再执行OnShutdown，避免关闭数据库等资源时还有请求在写响应
+		server.Close()
+	}
+	for _, hook := range hooks {
+		hook()
+	}
+	if closeErr := log.Close(); err == nil {
+		err = closeErr
+	}
+	close(done)
+	return err
+}
@@ -0,0 +1,135 @@
+package wygo
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// 开启H2C后，同一个端口上h2c客户端走HTTP/2，普通客户端仍然走HTTP/1.1
+func TestRunListenerH2C(t *testing.T) {
+	engine := New()
+	engine.Config().H2C = true
+	engine.GET("/proto", func(c *Context) {
+		if c.IsHTTP2() {
+			c.String("h2 %s", c.Proto())
+			return
+		}
+		c.String("h1 %s", c.Proto())
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- engine.RunListener(listener)
+	}()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := engine.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+		if err := <-errCh; err != nil {
+			t.Errorf("RunListener: %v", err)
+		}
+	}()
+	url := "http://" + listener.Addr().String() + "/proto"
+
+	h2c := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	defer h2c.CloseIdleConnections()
+	h1 := &http.Transport{}
+	defer h1.CloseIdleConnections()
+
+	tests := []struct {
+		name      string
+		transport http.RoundTripper
+		want      string
+		wantMajor int
+	}{
+		{"h2c", h2c, "h2 HTTP/2.0", 2},
+		{"http1.1", h1, "h1 HTTP/1.1", 1},
+	}
+	for _, tt := range tests {
+		resp, err := (&http.Client{Transport: tt.transport, Timeout: 5 * time.Second}).Get(url)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if resp.ProtoMajor != tt.wantMajor || string(body) != tt.want {
+			t.Errorf("%s: got %s %q, want HTTP/%d %q", tt.name, resp.Proto, body, tt.wantMajor, tt.want)
+		}
+	}
+}
+
+// 超过等待时间还没处理完的请求会被强制断开，之后才执行OnShutdown
+func TestShutdownTimeout(t *testing.T) {
+	engine := New()
+	started := make(chan struct{})
+	engine.GET("/slow", func(c *Context) {
+		close(started)
+		<-c.Req.Context().Done()
+	})
+	hookCalled := false
+	engine.OnShutdown(func() {
+		hookCalled = true
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: engine}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- engine.serve(context.Background(), server, func() error {
+			return server.Serve(listener)
+		})
+	}()
+	respErr := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+		respErr <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := engine.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !hookCalled {
+		t.Error("OnShutdown hook was not called")
+	}
+	select {
+	case err := <-respErr:
+		if err == nil {
+			t.Error("request finished normally, want the connection to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request is still running after Shutdown")
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("serve: %v", err)
+	}
+}
@@ -1,73 +1,268 @@
 package wygo
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
+type nodeType uint8
+
+const (
+	static   nodeType = iota // 静态路径，例如 /user/
+	param                    // 路径参数，例如 :id
+	catchAll                 // 通配剩余路径，例如 *filepath
+)
+
+// node 是压缩前缀树（radix tree）的一个节点
+// 静态节点之间按公共前缀合并，例如 /user/list 和 /users 会被拆成 /user -> [/list, s]
+// 通配节点总是挂在以 / 结尾的静态节点下面，并且独占一个路径段
 type node struct {
-	pattern  string  // 待匹配路由，例如 /p/:lang
-	part     string  // 路由中的一部分，例如 :lang
-	children []*node // 子节点，例如 [doc, tutorial, intro]
-	isWild   bool    // 是否精确匹配，part 含有 : 或 * 时为true
+	path     string   // 静态节点为压缩后的前缀，通配节点为 :id 或 *filepath
+	typ      nodeType // 节点类型
+	indices  string   // 每个静态子节点path的首字节，和children一一对应，用于快速查找
+	children []*node  // 静态子节点
+	// 通配子节点，带约束的参数排在前面，同一个位置无约束的参数和 *catchall 各最多一个
+	paramChildren []*node
+	catchAllChild *node
+	// 通配节点的参数名和约束，例如 :id<int> 的key为id，constraint为int
+	key        string
+	constraint string
+	check      paramConstraint
+	pattern    string        // 在这里结束的路由，例如 /p/:lang，不是路由终点时为空
+	handlers   []HandlerFunc // pattern对应的中间件和handler
 }
 
-// 从子节点中找到第一个匹配成功的节点，用于后续的插入
-func (n *node) matchChild(part string) *node {
-	// 遍历子节点
-	for _, child := range n.children {
-		// 如果part相同，或者说是*或者:，都算匹配
-		if child.part == part || child.isWild {
-			return child
+// 查找过程中收集的路径参数，由router放在sync.Pool里复用
+type routeParam struct {
+	key   string
+	value string
+}
+
+type routeParams []routeParam
+
+// 将pattern拆成静态片段和通配片段，例如 /user/:id/profile 拆成 [/user/ :id /profile]
+// 空的路径段会被忽略，遇到第一个*之后的部分也会被忽略
+func splitPattern(pattern string) []string {
+	tokens := make([]string, 0)
+	var sb strings.Builder
+	for _, part := range parsePattern(pattern) {
+		sb.WriteByte('/')
+		if part[0] != ':' && part[0] != '*' {
+			sb.WriteString(part)
+			continue
 		}
+		tokens = append(tokens, sb.String(), part)
+		sb.Reset()
+	}
+	if sb.Len() > 0 {
+		tokens = append(tokens, sb.String())
+	} else if len(tokens) == 0 {
+		// 根路径 /
+		tokens = append(tokens, "/")
+	}
+	return tokens
+}
+
+// 返回两个字符串的最长公共前缀的长度
+func longestCommonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// 根据首字节找到静态子节点
+func (n *node) staticChild(c byte) *node {
+	if i := strings.IndexByte(n.indices, c); i >= 0 {
+		return n.children[i]
 	}
 	return nil
 }
 
-// 从子节点中找到所有匹配成功的节点，用于后续的查找
-func (n *node) matchChildren(part string) []*node {
-	nodes := make([]*node, 0)
+// 在第i个字节处把节点拆成两段，后半段连同所有子节点和路由一起下移
+func (n *node) split(i int) {
+	rest := *n
+	rest.path = n.path[i:]
+	*n = node{
+		path:     n.path[:i],
+		typ:      static,
+		indices:  rest.path[:1],
+		children: []*node{&rest},
+	}
+}
+
+// 从n开始插入一段静态路径，返回这段路径结束处的节点
+func (n *node) insertStatic(s string) *node {
+	for s != "" {
+		child := n.staticChild(s[0])
+		if child == nil {
+			child = &node{path: s, typ: static}
+			n.indices += s[:1]
+			n.children = append(n.children, child)
+			return child
+		}
+		i := longestCommonPrefix(child.path, s)
+		if i < len(child.path) {
+			child.split(i)
+		}
+		n = child
+		s = s[i:]
+	}
+	return n
+}
+
+// 返回以这个节点为根的子树中任意一个已注册的pattern，用于冲突时的提示
+func (n *node) anyPattern() string {
+	if n.pattern != "" {
+		return n.pattern
+	}
 	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			nodes = append(nodes, child)
+		if pattern := child.anyPattern(); pattern != "" {
+			return pattern
 		}
 	}
-	return nodes
+	for _, child := range n.paramChildren {
+		if pattern := child.anyPattern(); pattern != "" {
+			return pattern
+		}
+	}
+	if n.catchAllChild != nil {
+		return n.catchAllChild.anyPattern()
+	}
+	return ""
 }
 
-// 插入到树中
-func (n *node) insert(pattern string, parts []string, height int) {
-	// 如果当前的高度跟parts一样多，就说明到了最底端，结束递归
-	if len(parts) == height {
-		// 将这个节点的pattern设置为这个pattern
-		n.pattern = pattern
-		return
-	}
-	// 看这一层的part是否有子节点匹配
-	part := parts[height]
-	child := n.matchChild(part)
-	// 没有 电话，就创建一个child，并插入作为它的子节点
-	if child == nil {
-		child = &node{part: part, isWild: part[0] == ':' || part[0] == '*'}
-		n.children = append(n.children, child)
-	}
-	// 到下一层
-	child.insert(pattern, parts, height+1)
+// 插入一个参数子节点，已经有完全相同的参数时直接复用
+// 同一个位置不能出现两个约束相同（包括都没有约束）但名字不同的参数
+func (n *node) insertParam(token string, pattern string) *node {
+	for _, child := range n.paramChildren {
+		if child.path == token {
+			return child
+		}
+	}
+	key, text, check := parseParamToken(token)
+	for _, child := range n.paramChildren {
+		if child.constraint == text {
+			panic(fmt.Sprintf("wygo: wildcard %s in route %s conflicts with %s in existing route %s",
+				token, pattern, child.path, child.anyPattern()))
+		}
+	}
+	child := &node{path: token, typ: param, key: key, constraint: text, check: check}
+	// 带约束的参数按注册顺序排在无约束的参数前面
+	i := len(n.paramChildren)
+	if i > 0 && n.paramChildren[i-1].check == nil {
+		i--
+	}
+	n.paramChildren = append(n.paramChildren, nil)
+	copy(n.paramChildren[i+1:], n.paramChildren[i:])
+	n.paramChildren[i] = child
+	return child
 }
 
-func (n *node) search(parts []string, height int) *node {
-	// 如果当前的高度跟parts一样多，或者这个节点的前缀有*，就结束递归
-	if len(parts) == height || strings.HasPrefix(n.part, "*") {
-		// 看它的pattern，理论上是有的，没有就返回nil
-		if n.pattern == "" {
-			return nil
+// 插入到树中，返回pattern结束处的节点，由调用方设置pattern和handler
+// 同一个位置出现了名字不同的同类通配符（如 :id 和 :name）时直接panic
+// :param<约束>、:param 和 *catchall 可以共存，查找时按优先级决定
+func (n *node) insert(pattern string) *node {
+	for _, token := range splitPattern(pattern) {
+		switch token[0] {
+		case ':':
+			n = n.insertParam(token, pattern)
+		case '*':
+			if n.catchAllChild == nil {
+				key, _, _ := parseParamToken(token)
+				n.catchAllChild = &node{path: token, typ: catchAll, key: key}
+			} else if n.catchAllChild.path != token {
+				panic(fmt.Sprintf("wygo: wildcard %s in route %s conflicts with %s in existing route %s",
+					token, pattern, n.catchAllChild.path, n.catchAllChild.anyPattern()))
+			}
+			n = n.catchAllChild
+		default:
+			n = n.insertStatic(token)
 		}
-		return n
 	}
-	part := parts[height]
-	children := n.matchChildren(part)
-	for _, child := range children {
-		result := child.search(parts, height+1)
-		if result != nil {
+	return n
+}
+
+// 在n的子节点中查找path，path是n之后剩下还没匹配的部分
+// 优先级：静态 > 带约束的:param（按注册顺序）> :param > *catchall；子树里匹配失败就回溯到下一个候选
+// 参数不满足约束时也会继续尝试后面的候选
+// ps不为nil时，匹配到的参数会追加到ps中，匹配失败时ps会恢复原样
+func (n *node) search(path string, ps *routeParams) *node {
+	if path == "" {
+		if n.pattern != "" {
+			return n
+		}
+		return nil
+	}
+	if child := n.staticChild(path[0]); child != nil && strings.HasPrefix(path, child.path) {
+		if result := child.search(path[len(child.path):], ps); result != nil {
 			return result
 		}
 	}
+	if len(n.paramChildren) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		for _, child := range n.paramChildren {
+			if end == 0 || child.check != nil && !child.check(path[:end]) {
+				continue
+			}
+			mark := 0
+			if ps != nil {
+				mark = len(*ps)
+				*ps = append(*ps, routeParam{key: child.key, value: path[:end]})
+			}
+			if result := child.search(path[end:], ps); result != nil {
+				return result
+			}
+			if ps != nil {
+				*ps = (*ps)[:mark]
+			}
+		}
+	}
+	if child := n.catchAllChild; child != nil {
+		if ps != nil && child.key != "" {
+			*ps = append(*ps, routeParam{key: child.key, value: path})
+		}
+		return child
+	}
 	return nil
 }
+
+// 和search一样查找path，但静态部分忽略大小写，不收集参数
+// 返回的fixed是按注册时的写法修正后的路径，用于重定向
+func (n *node) searchFold(path string, fixed []byte) (*node, []byte) {
+	if path == "" {
+		if n.pattern != "" {
+			return n, fixed
+		}
+		return nil, nil
+	}
+	for _, child := range n.children {
+		if len(path) >= len(child.path) && strings.EqualFold(path[:len(child.path)], child.path) {
+			if result, buf := child.searchFold(path[len(child.path):], append(fixed, child.path...)); result != nil {
+				return result, buf
+			}
+		}
+	}
+	if len(n.paramChildren) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		for _, child := range n.paramChildren {
+			if end == 0 || child.check != nil && !child.check(path[:end]) {
+				continue
+			}
+			if result, buf := child.searchFold(path[end:], append(fixed, path[:end]...)); result != nil {
+				return result, buf
+			}
+		}
+	}
+	if child := n.catchAllChild; child != nil {
+		return child, append(fixed, path...)
+	}
+	return nil, nil
+}
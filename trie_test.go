@@ -0,0 +1,65 @@
+package wygo
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 匹配优先级固定为 静态 > :param > *catchall，和注册顺序无关
+var priorityRoutes = []string{
+	"/",
+	"/user/new",
+	"/user/:id",
+	"/user/:id/profile",
+	"/user/*rest",
+	"/static/*filepath",
+}
+
+var priorityCases = []struct {
+	path    string
+	pattern string
+	params  map[string]string
+}{
+	{"/", "/", nil},
+	{"/user/new", "/user/new", nil},
+	{"/user/42", "/user/:id", map[string]string{"id": "42"}},
+	// 静态的/user/new只匹配了前缀，回溯到:id
+	{"/user/newbie", "/user/:id", map[string]string{"id": "newbie"}},
+	// /user/new下面没有/profile，回溯到:id
+	{"/user/new/profile", "/user/:id/profile", map[string]string{"id": "new"}},
+	{"/user/42/profile", "/user/:id/profile", map[string]string{"id": "42"}},
+	// :id的子树中匹配不到时退回*rest
+	{"/user/42/other", "/user/*rest", map[string]string{"rest": "42/other"}},
+	{"/user/new/profile/edit", "/user/*rest", map[string]string{"rest": "new/profile/edit"}},
+	{"/static/css/site.css", "/static/*filepath", map[string]string{"filepath": "css/site.css"}},
+	{"/nope", "", nil},
+	{"/static", "", nil},
+}
+
+func TestRoutePriority(t *testing.T) {
+	reversed := make([]string, len(priorityRoutes))
+	for i, pattern := range priorityRoutes {
+		reversed[len(priorityRoutes)-1-i] = pattern
+	}
+	orders := map[string][]string{"forward": priorityRoutes, "reversed": reversed}
+	for name, routes := range orders {
+		r := newRouter()
+		for _, pattern := range routes {
+			r.addRoute(nil, "GET", pattern, nil)
+		}
+		for _, tc := range priorityCases {
+			n, params := r.getRoute(nil, "", "GET", tc.path)
+			pattern := ""
+			if n != nil {
+				pattern = n.pattern
+			}
+			if pattern != tc.pattern {
+				t.Errorf("%s: GET %s matched %q, want %q", name, tc.path, pattern, tc.pattern)
+				continue
+			}
+			if (len(params) > 0 || len(tc.params) > 0) && !reflect.DeepEqual(params, tc.params) {
+				t.Errorf("%s: GET %s params = %v, want %v", name, tc.path, params, tc.params)
+			}
+		}
+	}
+}
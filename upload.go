@@ -0,0 +1,322 @@
+package wygo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrFileTooLarge 上传的文件超过了MaxUploadFileSize
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrFileType 上传的文件类型不在AllowedUploadTypes中
+	ErrFileType = errors.New("file type not allowed")
+)
+
+// UploadError 描述一个没有通过大小或类型限制的上传文件，Err为ErrFileTooLarge或ErrFileType
+type UploadError struct {
+	Field       string // 表单中的字段名
+	Filename    string
+	ContentType string
+	Err         error
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("wygo: upload %s (%s): %v", e.Field, e.Filename, e.Err)
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// 单个上传文件的限制，默认取自Config，可以通过UploadLimit按路由覆盖
+type uploadLimits struct {
+	maxFileSize  int64
+	allowedTypes []string
+}
+
+var uploadLimitsKey = NewKey[uploadLimits]("wygo.uploadLimits")
+
+// UploadLimit 返回一个中间件，覆盖后面的handler中上传文件的大小和类型限制
+// maxFileSize为0时不限制大小，allowedTypes为空时不限制类型，类型可以写成 image/* 这样的通配
+// e.g. r.POST("/avatar", wygo.UploadLimit(2<<20, "image/png", "image/jpeg"), uploadAvatar)
+func UploadLimit(maxFileSize int64, allowedTypes ...string) HandlerFunc {
+	limits := uploadLimits{maxFileSize: maxFileSize, allowedTypes: allowedTypes}
+	return func(c *Context) {
+		uploadLimitsKey.Set(c, limits)
+	}
+}
+
+func (c *Context) uploadLimits() uploadLimits {
+	if limits, ok := uploadLimitsKey.Get(c); ok {
+		return limits
+	}
+	return uploadLimits{
+		maxFileSize:  c.engine.config.MaxUploadFileSize,
+		allowedTypes: c.engine.config.AllowedUploadTypes,
+	}
+}
+
+// 检查文件大小和类型，contentType是实际检测出来的类型
+func (l uploadLimits) check(field string, filename string, size int64, contentType string) error {
+	var err error
+	if l.maxFileSize > 0 && size > l.maxFileSize {
+		err = ErrFileTooLarge
+	} else if !l.allowType(contentType) {
+		err = ErrFileType
+	}
+	if err != nil {
+		return &UploadError{Field: field, Filename: filename, ContentType: contentType, Err: err}
+	}
+	return nil
+}
+
+func (l uploadLimits) allowType(contentType string) bool {
+	if len(l.allowedTypes) == 0 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, allowed := range l.allowedTypes {
+		if allowed == mediaType || strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, allowed[:len(allowed)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据文件开头的最多512个字节检测类型，客户端声明的类型可以被伪造，只在两种情况下使用：
+// 检测不出来（application/octet-stream）并且没有限制类型时；
+// 检测结果是text/plain，声明的是text/csv、application/json这样更具体的文本类型时，http.DetectContentType区分不出它们
+func (l uploadLimits) contentType(head []byte, declared string) string {
+	detected := http.DetectContentType(head)
+	if declared == "" {
+		return detected
+	}
+	if detected == "application/octet-stream" && len(l.allowedTypes) == 0 {
+		return declared
+	}
+	if strings.HasPrefix(detected, "text/plain") {
+		if mediaType, _, err := mime.ParseMediaType(declared); err == nil && isTextType(mediaType) {
+			return declared
+		}
+	}
+	return detected
+}
+
+// 内容是纯文本的类型
+func isTextType(mediaType string) bool {
+	switch mediaType {
+	case "application/json", "application/x-ndjson", "application/yaml", "application/toml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json")
+}
+
+// 在解析multipart表单之前，用MaxMultipartBodySize限制整个body的大小，避免无限制地写内存和临时文件
+func (c *Context) limitMultipartBody() {
+	if max := c.engine.config.MaxMultipartBodySize; max > 0 && c.Req.MultipartForm == nil {
+		c.Req.Body = http.MaxBytesReader(c.Writer, c.Req.Body, max)
+	}
+}
+
+// 按Config.MaxMultipartMemory解析multipart表单，PostForm等方法第一次读取表单之前调用
+// 和http.Request.FormValue一样忽略解析错误
+func (c *Context) parseMultipartForm() {
+	if c.Req.MultipartForm == nil && c.contentType() == "multipart/form-data" {
+		c.limitMultipartBody()
+		c.Req.ParseMultipartForm(c.engine.config.MaxMultipartMemory)
+	}
+}
+
+// MultipartForm 按Config.MaxMultipartMemory解析multipart表单，超出的部分写到临时文件
+// 整个body超过Config.MaxMultipartBodySize时返回*http.MaxBytesError
+// 返回之前会检查所有文件的大小和类型，不满足限制时返回*UploadError，检查的结果在同一个请求中会被复用
+// 文件在检查之前已经被完整读取，需要在读取过程中就限制单个文件的大小时使用StreamUploads
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	if !c.multipartChecked {
+		c.limitMultipartBody()
+		c.multipartChecked = true
+		c.multipartErr = c.checkMultipartForm()
+	}
+	if c.multipartErr != nil {
+		return nil, c.multipartErr
+	}
+	return c.Req.MultipartForm, nil
+}
+
+func (c *Context) checkMultipartForm() error {
+	if err := c.Req.ParseMultipartForm(c.engine.config.MaxMultipartMemory); err != nil {
+		return err
+	}
+	limits := c.uploadLimits()
+	for field, files := range c.Req.MultipartForm.File {
+		for _, fh := range files {
+			contentType, err := limits.fileHeaderType(fh)
+			if err != nil {
+				return err
+			}
+			if err := limits.check(field, fh.Filename, fh.Size, contentType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l uploadLimits) fileHeaderType(fh *multipart.FileHeader) (string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return l.contentType(head[:n], fh.Header.Get("Content-Type")), nil
+}
+
+// FormFile 返回表单中name对应的第一个文件
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	if files := form.File[name]; len(files) > 0 {
+		return files[0], nil
+	}
+	return nil, http.ErrMissingFile
+}
+
+// PostFormFile 同FormFile
+func (c *Context) PostFormFile(key string) (*multipart.FileHeader, error) {
+	return c.FormFile(key)
+}
+
+// SaveUploadedFile 把上传的文件保存到dst，dst所在的目录不存在时会创建
+func (c *Context) SaveUploadedFile(fh *multipart.FileHeader, dst string) error {
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = saveFile(src, dst)
+	return err
+}
+
+// 把r的内容写到dst，失败时删除写了一半的文件
+func saveFile(r io.Reader, dst string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return 0, err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return n, err
+}
+
+// UploadPart 是流式读取multipart请求时的一个字段，文件的内容不会整个放在内存或者临时文件里
+// 读取超过大小限制时返回*UploadError
+type UploadPart struct {
+	FieldName   string
+	Filename    string // 普通的表单字段为空
+	ContentType string // 文件为检测出来的类型，普通字段为客户端声明的类型
+	Header      textproto.MIMEHeader
+	r           io.Reader
+	limit       int64
+	read        int64
+	err         error
+}
+
+// IsFile 判断这个字段是不是文件
+func (p *UploadPart) IsFile() bool {
+	return p.Filename != ""
+}
+
+// 超过大小限制之后不再读取，之后的每次调用都返回0和同一个错误
+func (p *UploadPart) Read(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	if p.limit > 0 {
+		// 最多比限制多读一个字节，用来判断文件是否超过了限制
+		if max := p.limit - p.read + 1; int64(len(b)) > max {
+			b = b[:max]
+		}
+	}
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if p.limit > 0 && p.read > p.limit {
+		n -= int(p.read - p.limit)
+		p.read = p.limit
+		p.err = &UploadError{Field: p.FieldName, Filename: p.Filename, ContentType: p.ContentType, Err: ErrFileTooLarge}
+		return n, p.err
+	}
+	return n, err
+}
+
+// Save 把这个字段的内容保存到dst，超过大小限制时删除写了一半的文件并返回错误
+func (p *UploadPart) Save(dst string) (int64, error) {
+	return saveFile(p, dst)
+}
+
+// StreamUploads 按顺序读取multipart请求中的每个字段并交给fn处理，适合很大的文件
+// 文件的类型在fn读取数据之前检查，大小在读取过程中检查，fn返回错误时停止读取
+// 没有被fn读完的字段会被跳过；使用StreamUploads之后不能再调用MultipartForm、FormFile和BindForm
+func (c *Context) StreamUploads(fn func(part *UploadPart) error) error {
+	reader, err := c.Req.MultipartReader()
+	if err != nil {
+		return err
+	}
+	limits := c.uploadLimits()
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		up := &UploadPart{
+			FieldName:   part.FormName(),
+			Filename:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Header:      part.Header,
+			r:           part,
+		}
+		if up.IsFile() {
+			br := bufio.NewReaderSize(part, 512)
+			head, err := br.Peek(512)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			up.ContentType = limits.contentType(head, up.ContentType)
+			up.r, up.limit = br, limits.maxFileSize
+			if err := limits.check(up.FieldName, up.Filename, int64(len(head)), up.ContentType); err != nil {
+				return err
+			}
+		}
+		err = fn(up)
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
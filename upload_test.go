@@ -0,0 +1,142 @@
+package wygo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+var (
+	pngData  = []byte("\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 100))
+	jpegData = []byte("\xff\xd8\xff" + strings.Repeat("\x00", 100))
+	// Windows可执行文件，检测不出类型
+	exeData = []byte("MZ\x90\x00" + strings.Repeat("\x00", 100))
+	csvData = []byte("id,name\n1,wygo\n")
+)
+
+// 在data后面补n个0字节
+func padded(data []byte, n int) []byte {
+	return append(append([]byte(nil), data...), make([]byte, n)...)
+}
+
+// 构造只有一个文件字段file的multipart请求，contentType为空时不声明类型
+func uploadRequest(t *testing.T, path string, filename string, contentType string, data []byte) *http.Request {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	mw.Close()
+	req := httptest.NewRequest("POST", path, body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func newUploadEngine() *Engine {
+	engine := New()
+	engine.Config().MaxUploadFileSize = 1000
+	engine.Config().AllowedUploadTypes = []string{"image/png", "image/jpeg", "text/csv"}
+	engine.Config().MaxMultipartBodySize = 4 << 10
+	engine.POST("/upload", func(c *Context) {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.AbortWithBindError(err)
+			return
+		}
+		c.String("%s %d", fh.Filename, fh.Size)
+	})
+	// 这个路由只限制大小，不限制类型
+	engine.POST("/stream", UploadLimit(100), func(c *Context) {
+		var size int64
+		err := c.StreamUploads(func(part *UploadPart) error {
+			n, err := io.Copy(io.Discard, part)
+			size += n
+			return err
+		})
+		if err != nil {
+			c.AbortWithBindError(err)
+			return
+		}
+		c.String("%d", size)
+	})
+	return engine
+}
+
+func TestUploadLimits(t *testing.T) {
+	engine := newUploadEngine()
+	tests := []struct {
+		name        string
+		path        string
+		filename    string
+		contentType string
+		data        []byte
+		status      int
+		body        string
+	}{
+		{"png", "/upload", "a.png", "image/png", pngData, http.StatusOK, "a.png 108"},
+		{"undeclared jpeg", "/upload", "a.jpg", "", jpegData, http.StatusOK, "a.jpg 103"},
+		{"too large", "/upload", "big.png", "image/png", padded(pngData, 1000), http.StatusRequestEntityTooLarge, ""},
+		// 类型按内容检测，不看文件名和声明的类型
+		{"sniffed type not allowed", "/upload", "a.gif", "image/gif", []byte("GIF89a" + strings.Repeat("\x00", 100)), http.StatusUnsupportedMediaType, ""},
+		{"spoofed content type", "/upload", "evil.png", "image/png", exeData, http.StatusUnsupportedMediaType, ""},
+		{"spoofed text type", "/upload", "evil.csv", "text/csv", exeData, http.StatusUnsupportedMediaType, ""},
+		// 纯文本只能检测出text/plain，使用声明的更具体的文本类型
+		{"csv", "/upload", "a.csv", "text/csv", csvData, http.StatusOK, "a.csv 15"},
+		{"plain text", "/upload", "a.txt", "text/plain", csvData, http.StatusUnsupportedMediaType, ""},
+		{"text declared as image", "/upload", "a.png", "image/png", csvData, http.StatusUnsupportedMediaType, ""},
+		// 整个body超过MaxMultipartBodySize
+		{"body too large", "/upload", "huge.png", "image/png", padded(pngData, 8<<10), http.StatusRequestEntityTooLarge, ""},
+		// 流式读取时正好等于限制的文件可以读完，多一个字节就返回413
+		{"stream at limit", "/stream", "a.bin", "", make([]byte, 100), http.StatusOK, "100"},
+		{"stream over limit", "/stream", "a.bin", "", make([]byte, 101), http.StatusRequestEntityTooLarge, ""},
+		{"stream far over limit", "/stream", "a.bin", "", make([]byte, 5000), http.StatusRequestEntityTooLarge, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, uploadRequest(t, tt.path, tt.filename, tt.contentType, tt.data))
+		if w.Code != tt.status || tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+// 超过限制之后，UploadPart.Read不会返回超出限制的数据，之后一直返回同一个错误
+func TestUploadPartRead(t *testing.T) {
+	const limit = 100
+	part := &UploadPart{FieldName: "file", Filename: "a.bin", r: bytes.NewReader(make([]byte, 1000)), limit: limit}
+	buf := make([]byte, 64)
+	total := 0
+	var err error
+	for err == nil {
+		var n int
+		n, err = part.Read(buf)
+		if n < 0 || n > len(buf) {
+			t.Fatalf("Read returned n = %d", n)
+		}
+		total += n
+	}
+	if total != limit {
+		t.Errorf("read %d bytes, want %d", total, limit)
+	}
+	var uploadErr *UploadError
+	if !errors.As(err, &uploadErr) || uploadErr.Err != ErrFileTooLarge {
+		t.Fatalf("Read error = %v, want ErrFileTooLarge", err)
+	}
+	if n, again := part.Read(buf); n != 0 || again != err {
+		t.Errorf("Read after the limit = %d, %v, want 0, %v", n, again, err)
+	}
+}
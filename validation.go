@@ -0,0 +1,357 @@
+package wygo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidatorFunc 校验一个字段的值，param是tag中=后面的部分，例如 min=1 中的1
+// 指针字段会先解引用，nil指针只会经过required的校验
+type ValidatorFunc func(value reflect.Value, param string) bool
+
+// 内置的校验规则，写在 `validate:"required,min=1,max=100,email,oneof=a b"` 中
+// omitempty不是校验规则，字段为零值时跳过它后面的所有规则
+var builtinValidators = map[string]ValidatorFunc{
+	"required": func(v reflect.Value, _ string) bool {
+		return !isEmptyValue(v)
+	},
+	"min": func(v reflect.Value, param string) bool {
+		n, ok := validationSize(v)
+		return ok && n >= parseValidationParam(param)
+	},
+	"max": func(v reflect.Value, param string) bool {
+		n, ok := validationSize(v)
+		return ok && n <= parseValidationParam(param)
+	},
+	"len": func(v reflect.Value, param string) bool {
+		n, ok := validationSize(v)
+		return ok && n == parseValidationParam(param)
+	},
+	"email": func(v reflect.Value, _ string) bool {
+		if v.Kind() != reflect.String {
+			return false
+		}
+		addr, err := mail.ParseAddress(v.String())
+		return err == nil && addr.Address == v.String()
+	},
+	"oneof": func(v reflect.Value, param string) bool {
+		s := fmt.Sprint(v.Interface())
+		for _, option := range strings.Fields(param) {
+			if s == option {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+func init() {
+	// 路径参数的约束也可以用来校验字符串，例如 validate:"uuid"
+	for _, name := range []string{"uuid", "alpha", "alnum"} {
+		check := builtinConstraints[name]
+		builtinValidators[name] = func(v reflect.Value, _ string) bool {
+			return v.Kind() == reflect.String && check(v.String())
+		}
+	}
+}
+
+// RegisterValidator 注册自定义的校验规则，可以覆盖同名的内置规则，需要在处理请求之前调用
+func (engine *Engine) RegisterValidator(name string, fn ValidatorFunc) {
+	if name == "" || name == "omitempty" || strings.ContainsAny(name, ",=") {
+		panic(fmt.Sprintf("wygo: invalid validator name %q", name))
+	}
+	if fn == nil {
+		panic(fmt.Sprintf("wygo: validator %s must not be nil", name))
+	}
+	engine.validators[name] = fn
+}
+
+func (engine *Engine) validator(name string) ValidatorFunc {
+	if engine != nil {
+		if fn, ok := engine.validators[name]; ok {
+			return fn
+		}
+	}
+	return builtinValidators[name]
+}
+
+// FieldError 描述一个没有通过校验的字段
+type FieldError struct {
+	Field       string // JSON中的字段名，嵌套的字段用.连接，例如 address.city、items[0].name
+	StructField string // 结构体中的字段名，例如 Address.City
+	Tag         string // 没有通过的规则，例如 min
+	Param       string // 规则的参数，例如 min=1 中的1
+	Value       interface{}
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("wygo: field %s %s", e.Field, e.Message())
+}
+
+// Message 返回给客户端看的错误描述
+func (e *FieldError) Message() string {
+	switch e.Tag {
+	case "required":
+		return "is required"
+	case "min":
+		return "must be at least " + e.Param
+	case "max":
+		return "must be at most " + e.Param
+	case "len":
+		return "must have length " + e.Param
+	case "email":
+		return "must be a valid email address"
+	case "oneof":
+		return "must be one of [" + e.Param + "]"
+	}
+	if e.Param != "" {
+		return fmt.Sprintf("failed on %s=%s", e.Tag, e.Param)
+	}
+	return "failed on " + e.Tag
+}
+
+// ValidationErrors 收集一次校验中所有没有通过的字段
+type ValidationErrors []*FieldError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate 按validate tag校验obj，obj可以是结构体或者结构体指针
+// 所有没有通过的字段以ValidationErrors返回
+func (engine *Engine) Validate(obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs ValidationErrors
+	engine.validateStruct(v, "", "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate 使用engine中注册的规则校验obj，Bind系列方法在绑定成功后会自动调用
+func (c *Context) Validate(obj interface{}) error {
+	return c.engine.Validate(obj)
+}
+
+// 一个字段上解析好的校验规则
+type fieldRules struct {
+	index     int
+	name      string // 结构体中的字段名
+	jsonName  string
+	omitEmpty bool
+	rules     []fieldRule
+}
+
+type fieldRule struct {
+	tag   string
+	param string
+}
+
+// 每个结构体类型的tag只解析一次
+var structRulesCache sync.Map // map[reflect.Type][]fieldRules
+
+func structRules(t reflect.Type) []fieldRules {
+	if cached, ok := structRulesCache.Load(t); ok {
+		return cached.([]fieldRules)
+	}
+	fields := make([]fieldRules, 0)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("validate")
+		if !sf.IsExported() || tag == "-" {
+			continue
+		}
+		fr := fieldRules{index: i, name: sf.Name, jsonName: jsonFieldName(sf)}
+		for _, item := range strings.Split(tag, ",") {
+			if item == "" {
+				continue
+			}
+			if item == "omitempty" {
+				fr.omitEmpty = true
+				continue
+			}
+			rule := fieldRule{tag: item}
+			if j := strings.IndexByte(item, '='); j >= 0 {
+				rule.tag, rule.param = item[:j], item[j+1:]
+			}
+			fr.rules = append(fr.rules, rule)
+		}
+		fields = append(fields, fr)
+	}
+	structRulesCache.Store(t, fields)
+	return fields
+}
+
+// 字段在请求中的名字，依次看json、query、path、header和form tag，都没有时使用字段名
+func jsonFieldName(sf reflect.StructField) string {
+	for _, tag := range []string{"json", sourceQuery, sourcePath, sourceHeader, sourceForm} {
+		if name := strings.Split(sf.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+func (engine *Engine) validateStruct(v reflect.Value, jsonPrefix string, structPrefix string, errs *ValidationErrors) {
+	for _, fr := range structRules(v.Type()) {
+		fv := v.Field(fr.index)
+		jsonName, structName := jsonPrefix+fr.jsonName, structPrefix+fr.name
+		if fr.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		for _, rule := range fr.rules {
+			fn := engine.validator(rule.tag)
+			if fn == nil {
+				panic(fmt.Sprintf("wygo: unknown validator %s on field %s.%s", rule.tag, v.Type(), fr.name))
+			}
+			elem := fv
+			for elem.Kind() == reflect.Pointer && !elem.IsNil() {
+				elem = elem.Elem()
+			}
+			// nil指针只检查required，其他规则交给required决定
+			if elem.Kind() == reflect.Pointer && rule.tag != "required" {
+				continue
+			}
+			if !fn(elem, rule.param) {
+				*errs = append(*errs, &FieldError{
+					Field:       jsonName,
+					StructField: structName,
+					Tag:         rule.tag,
+					Param:       rule.param,
+					Value:       fv.Interface(),
+				})
+				// 同一个字段只报告第一个没有通过的规则
+				break
+			}
+		}
+		engine.validateNested(fv, jsonName, structName, errs)
+	}
+}
+
+// 继续校验结构体字段，以及结构体切片中的每个元素
+func (engine *Engine) validateNested(v reflect.Value, jsonName string, structName string, errs *ValidationErrors) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if !isScalarType(v.Type()) {
+			engine.validateStruct(v, jsonName+".", structName+".", errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			suffix := "[" + strconv.Itoa(i) + "]"
+			engine.validateNested(v.Index(i), jsonName+suffix, structName+suffix, errs)
+		}
+	}
+}
+
+// 零值、nil和长度为0的字符串、切片、map都算空
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return v.Len() == 0
+	case reflect.Invalid:
+		return true
+	}
+	return v.IsZero()
+}
+
+// 数字返回值本身，字符串返回字符数，切片和map返回长度
+func validationSize(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func parseValidationParam(param string) float64 {
+	f, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("wygo: invalid validator param %q: %v", param, err))
+	}
+	return f
+}
+
+// AbortWithBindError 把Bind、Validate或者上传返回的错误渲染成400（上传的错误为413或415）响应并中止后续的handler
+// 字段级的错误放在fields中，例如 {"error":"validation failed","fields":[{"field":"name","tag":"required","message":"is required"}]}
+func (c *Context) AbortWithBindError(err error) {
+	status, body := http.StatusBadRequest, J{"error": err.Error()}
+	var validationErrs ValidationErrors
+	var bindingErrs BindingErrors
+	var typeErr *json.UnmarshalTypeError
+	var uploadErr *UploadError
+	var bodyErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]J, len(validationErrs))
+		for i, e := range validationErrs {
+			fields[i] = J{"field": e.Field, "tag": e.Tag, "param": e.Param, "message": e.Message()}
+		}
+		body = J{"error": "validation failed", "fields": fields}
+	case errors.As(err, &bindingErrs):
+		fields := make([]J, len(bindingErrs))
+		for i, e := range bindingErrs {
+			message := fmt.Sprintf("invalid value %q", e.Value)
+			if errors.Is(e.Err, ErrMissingValue) {
+				message = "is required"
+			}
+			fields[i] = J{"field": e.Name, "source": e.Source, "message": message}
+		}
+		body = J{"error": "invalid parameters", "fields": fields}
+	case errors.As(err, &typeErr):
+		body = J{"error": "invalid body", "fields": []J{{
+			"field":   typeErr.Field,
+			"message": "must be " + typeErr.Type.String(),
+		}}}
+	case errors.As(err, &uploadErr):
+		// 上传的文件太大返回413，类型不允许返回415
+		status = http.StatusRequestEntityTooLarge
+		if errors.Is(uploadErr.Err, ErrFileType) {
+			status = http.StatusUnsupportedMediaType
+		}
+		body = J{"error": "invalid upload", "fields": []J{{
+			"field":   uploadErr.Field,
+			"message": uploadErr.Err.Error(),
+		}}}
+	case errors.As(err, &bodyErr):
+		status = http.StatusRequestEntityTooLarge
+		body = J{"error": "request body too large"}
+	}
+	c.SetStatusCode(status).JSON(body)
+	c.Abort()
+}
@@ -0,0 +1,193 @@
+package wygo
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMissingValue 表示请求中没有这个参数，或者参数的值为空
+var ErrMissingValue = errors.New("value is missing")
+
+// RequestValue 是从query、路由参数或表单中取出的一个原始值，调用Int、Bool等方法时才做转换
+// 转换失败时返回*BindingError，可以用BindingErrors.Add收集起来，一起交给AbortWithBindError
+//
+//	limit, err := c.QueryValue("limit").Default("10").Int()
+type RequestValue struct {
+	Source string // query、path或form
+	Name   string
+	Raw    string
+	Exists bool // 请求中是否有这个参数
+}
+
+// QueryValue 返回query中key对应的值，和QueryInt等方法一样，重复出现时使用最后一个
+func (c *Context) QueryValue(key string) RequestValue {
+	v := RequestValue{Source: sourceQuery, Name: key}
+	if vals := c.QueryAll()[key]; len(vals) > 0 {
+		v.Raw, v.Exists = vals[len(vals)-1], true
+	}
+	return v
+}
+
+// ParamValue 返回路由参数key对应的值
+func (c *Context) ParamValue(key string) RequestValue {
+	raw, ok := c.Params[key]
+	return RequestValue{Source: sourcePath, Name: key, Raw: raw, Exists: ok}
+}
+
+// PostFormValue 返回表单中key对应的值，和PostForm一样，表单中没有时也会查找query
+func (c *Context) PostFormValue(key string) RequestValue {
+	c.parseMultipartForm()
+	raw := c.Req.FormValue(key)
+	_, ok := c.Req.Form[key]
+	return RequestValue{Source: sourceForm, Name: key, Raw: raw, Exists: ok}
+}
+
+// Default 在值为空时使用s，之后的转换和请求中带了s一样
+func (v RequestValue) Default(s string) RequestValue {
+	if v.Raw == "" {
+		v.Raw = s
+	}
+	return v
+}
+
+// String 返回原始的字符串
+func (v RequestValue) String() string {
+	return v.Raw
+}
+
+// 转换前检查值是否为空，转换失败时包装成BindingError
+func (v RequestValue) parse(parse func(s string) error) error {
+	err := ErrMissingValue
+	if v.Raw != "" {
+		if err = parse(v.Raw); err == nil {
+			return nil
+		}
+	}
+	return &BindingError{Field: v.Name, Name: v.Name, Source: v.Source, Value: v.Raw, Err: err}
+}
+
+func (v RequestValue) Int() (int, error) {
+	n, err := v.intBits(strconv.IntSize)
+	return int(n), err
+}
+
+func (v RequestValue) Int64() (int64, error) {
+	return v.intBits(64)
+}
+
+// 按bitSize位解析整数，超出范围时返回错误而不是截断
+func (v RequestValue) intBits(bitSize int) (n int64, err error) {
+	err = v.parse(func(s string) (err error) {
+		n, err = strconv.ParseInt(s, 10, bitSize)
+		return err
+	})
+	return n, err
+}
+
+func (v RequestValue) Uint() (uint, error) {
+	n, err := v.uintBits(strconv.IntSize)
+	return uint(n), err
+}
+
+func (v RequestValue) Uint64() (uint64, error) {
+	return v.uintBits(64)
+}
+
+func (v RequestValue) uintBits(bitSize int) (n uint64, err error) {
+	err = v.parse(func(s string) (err error) {
+		n, err = strconv.ParseUint(s, 10, bitSize)
+		return err
+	})
+	return n, err
+}
+
+func (v RequestValue) Float32() (float32, error) {
+	f, err := v.float(32)
+	return float32(f), err
+}
+
+func (v RequestValue) Float64() (float64, error) {
+	return v.float(64)
+}
+
+func (v RequestValue) float(bitSize int) (f float64, err error) {
+	err = v.parse(func(s string) (err error) {
+		f, err = strconv.ParseFloat(s, bitSize)
+		return err
+	})
+	return f, err
+}
+
+// Bool 接受 1、t、true、0、f、false 等strconv.ParseBool支持的写法
+func (v RequestValue) Bool() (b bool, err error) {
+	err = v.parse(func(s string) (err error) {
+		b, err = strconv.ParseBool(s)
+		return err
+	})
+	return b, err
+}
+
+// Time 按layout解析时间，没有传layout时使用RFC3339，传了多个时依次尝试
+func (v RequestValue) Time(layouts ...string) (t time.Time, err error) {
+	if len(layouts) == 0 {
+		layouts = []string{time.RFC3339}
+	}
+	err = v.parse(func(s string) (err error) {
+		for _, layout := range layouts {
+			if t, err = time.Parse(layout, s); err == nil {
+				return nil
+			}
+		}
+		return err
+	})
+	return t, err
+}
+
+// Duration 解析 300ms、1h30m 这样的时长
+func (v RequestValue) Duration() (d time.Duration, err error) {
+	err = v.parse(func(s string) (err error) {
+		d, err = time.ParseDuration(s)
+		return err
+	})
+	return d, err
+}
+
+// UUID 检查值是否是 123e4567-e89b-12d3-a456-426614174000 这样的UUID，返回小写的形式
+func (v RequestValue) UUID() (id string, err error) {
+	err = v.parse(func(s string) error {
+		if !isUUID(s) {
+			return errors.New("invalid UUID")
+		}
+		id = strings.ToLower(s)
+		return nil
+	})
+	return id, err
+}
+
+// Add 收集RequestValue或Bind返回的错误，err为nil时什么也不做
+// 其他类型的错误也会被包装成BindingError加进来
+func (errs *BindingErrors) Add(err error) {
+	if err == nil {
+		return
+	}
+	var fieldErrs BindingErrors
+	var fieldErr *BindingError
+	switch {
+	case errors.As(err, &fieldErrs):
+		*errs = append(*errs, fieldErrs...)
+	case errors.As(err, &fieldErr):
+		*errs = append(*errs, fieldErr)
+	default:
+		*errs = append(*errs, &BindingError{Err: err})
+	}
+}
+
+// Err 没有收集到错误时返回nil，避免返回一个非nil的空BindingErrors
+func (errs BindingErrors) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,38 @@
+package wygo
+
+import "net/http"
+
+// WrapH 把http.Handler包装成HandlerFunc
+func WrapH(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		h.ServeHTTP(c.Writer, c.Req)
+	}
+}
+
+// WrapF 把http.HandlerFunc包装成HandlerFunc
+func WrapF(f http.HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+		f(c.Writer, c.Req)
+	}
+}
+
+// FromStdMiddleware 把标准库风格的中间件 func(http.Handler) http.Handler 转换成wygo的中间件
+// 中间件调用next时继续执行Context中后面的handler，它替换过的ResponseWriter和Request（包括其中的context）
+// 对后面的handler可见，中间件返回后恢复原来的值；中间件没有调用next时，后面的handler不再执行
+// e.g. r.Use(wygo.FromStdMiddleware(cors.Default().Handler))
+func FromStdMiddleware(middleware func(http.Handler) http.Handler) HandlerFunc {
+	return func(c *Context) {
+		called := false
+		writer, req, ctx := c.Writer, c.Req, c.Ctx
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			c.Writer, c.Req, c.Ctx = w, r, r.Context()
+			c.Next()
+		})
+		middleware(next).ServeHTTP(c.Writer, c.Req)
+		c.Writer, c.Req, c.Ctx = writer, req, ctx
+		if !called {
+			c.Abort()
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package wygo
 
 import (
+	"context"
 	"fmt"
 	"github.com/enginewang/wygo/log"
 	"html/template"
@@ -9,6 +10,8 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -29,15 +32,58 @@ type Config struct {
 	// 设置后台监管页面的账户
 	User     string
 	Password string
+	// 路径能在其他方法下匹配时返回405并带上Allow头，否则按404处理，默认开启
+	HandleMethodNotAllowed bool
+	// 没有注册HEAD的路径由GET的handler处理并丢弃body，默认开启
+	HandleHEAD bool
+	// 没有注册OPTIONS的路径自动返回204并在Allow头中列出已注册的方法，默认开启
+	HandleOPTIONS bool
+	// 请求路径和注册的路由只差末尾的/时，重定向到注册时的形式，GET为301，其他方法为308，默认开启
+	// 关闭时两种形式都直接匹配
+	RedirectTrailingSlash bool
+	// 请求路径含有重复的/、. 或者 .. 时，清理后重定向到注册时的形式，默认关闭
+	// 关闭时重复的/直接匹配，. 和 .. 不做处理
+	RedirectFixedPath bool
+	// 找不到路由时忽略大小写再查找一次，找到就重定向到注册时的写法，默认关闭
+	CaseInsensitive bool
+	// 优雅关闭时等待正在处理的请求的最长时间，为0时一直等待，默认10秒
+	ShutdownTimeout time.Duration
+	// 收到SIGINT或SIGTERM时优雅关闭server，默认关闭
+	HandleSignals bool
+	// http.Server的超时设置，为0时不限制；ReadHeaderTimeout默认10秒，防止slowloris
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// 请求header的最大字节数，为0时使用http.DefaultMaxHeaderBytes
+	MaxHeaderBytes int
+	// 以HTTP/2 cleartext（h2c）模式提供服务，同时支持HTTP/1.1，默认关闭
+	H2C bool
+	// 解析multipart表单时最多放在内存里的字节数，超出的部分写到临时文件，默认32MB
+	MaxMultipartMemory int64
+	// MultipartForm、FormFile等方法解析的整个multipart请求body的最大字节数，为0时不限制，默认32MB
+	// 更大的文件应该使用StreamUploads
+	MaxMultipartBodySize int64
+	// 单个上传文件的最大字节数，为0时不限制，默认不限制
+	MaxUploadFileSize int64
+	// 允许上传的文件类型，例如 image/png、image/*，为空时不限制
+	// 类型由http.DetectContentType根据文件开头的内容检测，检测不出来的文件视为application/octet-stream；
+	// 文本文件只能检测出text/plain，这时使用客户端声明的text/csv、application/json等文本类型
+	AllowedUploadTypes []string
 }
 
 type HandlerFunc func(*Context)
 
+// Mount注册的路由使用的方法，匹配任意方法的请求，包括CONNECT、TRACE和PROPFIND等自定义方法
+// 只有请求的方法（以及HEAD对应的GET）没有匹配的路由时才会使用
+const methodAny = "ANY"
+
 type RouterGroup struct {
 	prefix      string
 	middlewares []HandlerFunc // support middleware
 	parent      *RouterGroup  // support nesting
 	engine      *Engine       // all groups share a Engine instance
+	host        *hostRoutes   // 通过Engine.Host创建的group只匹配对应的Host
 }
 
 // Engine implement the interface of ServeHTTP
@@ -49,78 +95,151 @@ type Engine struct {
 	htmlTemplates *template.Template // for html render
 	funcMap       template.FuncMap   // for html render
 	config        *Config
+	// 按注册顺序保存的所有路由
+	routes []*Route
+	// 通过Route.Name命名的路由，用于URL反向生成
+	namedRoutes map[string]*Route
+	// 复用Context，请求结束后放回
+	pool sync.Pool
+	// 正在运行的server和关闭时执行的函数
+	server       *http.Server
+	serverMu     sync.Mutex
+	shutdownDone chan struct{}
+	onShutdown   []func()
+	// 路径不存在时的处理函数
+	noRoute []HandlerFunc
+	// 路径存在但方法不匹配时的处理函数
+	noMethod []HandlerFunc
+	// 通过RegisterValidator注册的校验规则
+	validators map[string]ValidatorFunc
 }
 
 // New is the constructor of wygo.Engine
 func New() *Engine {
-	engine := &Engine{router: newRouter(), config: newConfig()}
+	engine := &Engine{
+		router:      newRouter(),
+		config:      newConfig(),
+		namedRoutes: make(map[string]*Route),
+		noRoute:     []HandlerFunc{defaultNoRoute},
+		noMethod:    []HandlerFunc{defaultNoMethod},
+		validators:  make(map[string]ValidatorFunc),
+	}
+	engine.pool.New = func() any {
+		return &Context{engine: engine}
+	}
 	engine.RouterGroup = &RouterGroup{engine: engine}
 	engine.groups = []*RouterGroup{engine.RouterGroup}
-	fmt.Println(LOGO)
+	fmt.Print(LOGO)
 	return engine
 }
 
 func newConfig() *Config {
 	return &Config{
-		SameMiddlewareWarning: true,
-		WatchSystem:           true,
-		User:                  "",
-		Password:              "",
+		SameMiddlewareWarning:  true,
+		WatchSystem:            true,
+		User:                   "",
+		Password:               "",
+		HandleMethodNotAllowed: true,
+		HandleHEAD:             true,
+		HandleOPTIONS:          true,
+		RedirectTrailingSlash:  true,
+		ShutdownTimeout:        10 * time.Second,
+		ReadHeaderTimeout:      10 * time.Second,
+		MaxMultipartMemory:     32 << 20,
+		MaxMultipartBodySize:   32 << 20,
 	}
 }
 
+// Config returns the engine config, which can be modified before Run
+func (engine *Engine) Config() *Config {
+	return engine.config
+}
+
+// NoRoute sets the handlers for requests that match no route,
+// they run after the group middlewares like any other route
+func (engine *Engine) NoRoute(handlers ...HandlerFunc) {
+	engine.noRoute = handlers
+}
+
+// NoMethod sets the handlers for requests whose path is registered under other methods only,
+// the Allow header has already been set when they are called
+func (engine *Engine) NoMethod(handlers ...HandlerFunc) {
+	engine.noMethod = handlers
+}
+
 func (group *RouterGroup) Group(prefix string) *RouterGroup {
 	engine := group.engine
 	newGroup := &RouterGroup{
 		prefix: group.prefix + prefix,
 		parent: group,
 		engine: engine,
+		host:   group.host,
 	}
 	engine.groups = append(engine.groups, newGroup)
 	return newGroup
 }
 
-func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) {
+// handlers中最后一个是最终的handler，前面的是只作用于这个路由的中间件，在group中间件之后执行
+func (group *RouterGroup) addRoute(method string, comp string, handlers []HandlerFunc) *Route {
 	pattern := group.prefix + comp
-	log.Infof("Route %4s - %s", method, pattern)
-	group.engine.router.addRoute(method, pattern, handler)
+	if len(handlers) == 0 {
+		panic(fmt.Sprintf("wygo: route %s %s has no handler", method, pattern))
+	}
+	chain := group.combineHandlers(handlers...)
+	group.engine.router.addRoute(group.host, method, pattern, chain)
+	route := &Route{
+		Method:      method,
+		Pattern:     pattern,
+		handlers:    chain,
+		segments:    parseRouteSegments(pattern),
+		middlewares: handlers[:len(handlers)-1],
+		group:       group,
+		engine:      group.engine,
+	}
+	group.engine.routes = append(group.engine.routes, route)
+	return route
 }
 
 // GET defines the method to add GET request
-func (group *RouterGroup) GET(pattern string, handler HandlerFunc) {
-	group.addRoute("GET", pattern, handler)
+// the last handler is the final one, the others are middlewares only for this route
+// e.g. r.GET("/login", RateLimit(), login)
+func (group *RouterGroup) GET(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("GET", pattern, handlers)
 }
 
 // POST defines the method to add POST request
-func (group *RouterGroup) POST(pattern string, handler HandlerFunc) {
-	group.addRoute("POST", pattern, handler)
+func (group *RouterGroup) POST(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("POST", pattern, handlers)
+}
+
+func (group *RouterGroup) PUT(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("PUT", pattern, handlers)
+}
+
+func (group *RouterGroup) UPDATE(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("UPDATE", pattern, handlers)
 }
 
-func (group *RouterGroup) PUT(pattern string, handler HandlerFunc) {
-	group.addRoute("PUT", pattern, handler)
+func (group *RouterGroup) DELETE(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("DELETE", pattern, handlers)
 }
 
-func (group *RouterGroup) UPDATE(pattern string, handler HandlerFunc) {
-	group.addRoute("UPDATE", pattern, handler)
+func (group *RouterGroup) PATCH(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("PATCH", pattern, handlers)
 }
 
-func (group *RouterGroup) DELETE(pattern string, handler HandlerFunc) {
-	group.addRoute("DELETE", pattern, handler)
+func (group *RouterGroup) HEAD(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("HEAD", pattern, handlers)
 }
 
-func (group *RouterGroup) PATCH(pattern string, handler HandlerFunc) {
-	group.addRoute("PATCH", pattern, handler)
+func (group *RouterGroup) OPTIONS(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute("OPTIONS", pattern, handlers)
 }
 
 // Run defines the method to start a http server
+// it returns nil after a graceful shutdown, see RunWithContext
 func (engine *Engine) Run(addr string) (err error) {
-	for _, group := range engine.groups {
-		if group.prefix != "" {
-			group.PrintMiddlewares()
-		}
-	}
-	fmt.Printf("Wygo Serve on %v\n", addr)
-	return http.ListenAndServe(addr, engine)
+	return engine.RunWithContext(context.Background(), addr)
 }
 
 type MiddlewareHandler interface {
@@ -135,6 +254,8 @@ func (mc MiddlewareChain) BeUsed(group *RouterGroup) {
 	group.middlewares = append(group.middlewares, mc.Middlewares...)
 }
 
+// Use adds middlewares to the group, they apply to the routes registered on the group
+// and its sub groups afterwards, so call it before registering routes
 func (group *RouterGroup) Use(mh ...MiddlewareHandler) *RouterGroup {
 	//group.middlewares = append(group.middlewares, middlewares...)
 	for _, m := range mh {
@@ -150,9 +271,13 @@ func (group *RouterGroup) UseChain(chain *MiddlewareChain) *RouterGroup {
 	return group
 }
 
+// 获取函数名，闭包返回外层函数的名字，例如 middleware.Logger.func1 返回 Logger
 func getFuncName(i interface{}) string {
 	tmp := strings.Split(runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name(), ".")
-	return strings.Join(tmp[len(tmp)-2:len(tmp)-1], ".")
+	for len(tmp) > 1 && strings.HasPrefix(tmp[len(tmp)-1], "func") {
+		tmp = tmp[:len(tmp)-1]
+	}
+	return strings.TrimSuffix(tmp[len(tmp)-1], "-fm")
 }
 
 func (group *RouterGroup) PrintMiddlewares() {
@@ -164,6 +289,18 @@ func (group *RouterGroup) PrintMiddlewares() {
 		}
 	}
 	log.Info(str)
+	for _, route := range group.engine.routes {
+		if route.group == group && len(route.middlewares) > 0 {
+			str := fmt.Sprintf("Route [%v %v] \t [Middlewares] \t ", route.Method, route.Pattern)
+			for i, middleware := range route.middlewares {
+				str += getFuncName(middleware)
+				if i != len(route.middlewares)-1 {
+					str += "<->"
+				}
+			}
+			log.Info(str)
+		}
+	}
 }
 
 func (group *RouterGroup) createStaticHandler(relativePath string, fs http.FileSystem) HandlerFunc {
@@ -180,31 +317,121 @@ func (group *RouterGroup) createStaticHandler(relativePath string, fs http.FileS
 }
 
 // serve static files
-func (group *RouterGroup) Static(relativePath string, root string) {
+func (group *RouterGroup) Static(relativePath string, root string) *Route {
 	handler := group.createStaticHandler(relativePath, http.Dir(root))
 	urlPattern := path.Join(relativePath, "/*filepath")
-	group.GET(urlPattern, handler)
+	return group.GET(urlPattern, handler)
+}
+
+// Mount 把任意的http.Handler挂在group下的prefix路径上，所有方法的请求都会交给它处理
+// 同一路径上单独注册的方法优先，Routes中显示为两条方法为ANY的路由
+// 转发前会和http.StripPrefix一样去掉prefix，例如 Mount("/debug", mux) 时 /debug/pprof/ 会以 /pprof/ 交给mux
+// prefix本身末尾有没有/都以 / 交给handler，不会被重定向；group的中间件仍然会先执行
+func (group *RouterGroup) Mount(prefix string, handler http.Handler) {
+	exact := strings.TrimSuffix(prefix, "/")
+	if group.prefix+exact == "" {
+		exact = "/"
+	}
+	// prefix占的路径段数，用来去掉RawPath中的prefix
+	depth := len(parsePattern(group.prefix + exact))
+	mountHandler := func(c *Context) {
+		rest := c.ParamString("mountpath", "")
+		req := new(http.Request)
+		*req = *c.Req
+		u := *c.Req.URL
+		u.Path = "/" + rest
+		if rest != "" && strings.HasSuffix(c.Path, "/") {
+			u.Path += "/"
+		}
+		// 保留 %2F 这样的转义，和Path对不上时url.URL会忽略RawPath
+		if u.RawPath != "" {
+			u.RawPath = stripSegments(u.RawPath, depth)
+		}
+		req.URL = &u
+		handler.ServeHTTP(c.Writer, req)
+	}
+	group.addRoute(methodAny, exact, []HandlerFunc{mountHandler})
+	group.addRoute(methodAny, path.Join(prefix, "/*mountpath"), []HandlerFunc{mountHandler})
+}
+
+// 去掉p开头的n个路径段，返回以/开头的剩余部分
+func stripSegments(p string, n int) string {
+	for ; n > 0; n-- {
+		p = strings.TrimLeft(p, "/")
+		i := strings.IndexByte(p, '/')
+		if i < 0 {
+			return "/"
+		}
+		p = p[i:]
+	}
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+// MountEngine 把另外一个单独构建的Engine挂在prefix路径上，规则同Mount
+func (group *RouterGroup) MountEngine(prefix string, engine *Engine) {
+	group.Mount(prefix, engine)
 }
 
 func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
 	engine.funcMap = funcMap
 }
 
+// LoadHTMLGlob loads templates, urlFor is always available in them
+// e.g. <a href="{{urlFor "user.show" .ID}}">
 func (engine *Engine) LoadHTMLGlob(pattern string) {
-	engine.htmlTemplates = template.Must(template.New("").Funcs(engine.funcMap).ParseGlob(pattern))
+	funcMap := template.FuncMap{"urlFor": engine.URL}
+	for name, fn := range engine.funcMap {
+		funcMap[name] = fn
+	}
+	engine.htmlTemplates = template.Must(template.New("").Funcs(funcMap).ParseGlob(pattern))
 }
 
-func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+// 从根group到当前group依次收集中间件，最后加上handlers，在注册路由时计算一次
+func (group *RouterGroup) combineHandlers(handlers ...HandlerFunc) []HandlerFunc {
+	var groups []*RouterGroup
+	for g := group; g != nil; g = g.parent {
+		groups = append(groups, g)
+	}
+	chain := make([]HandlerFunc, 0)
+	for i := len(groups) - 1; i >= 0; i-- {
+		chain = append(chain, groups[i].middlewares...)
+	}
+	chain = append(chain, handlers...)
+	// 限制容量，避免在请求中append时改写共享的调用链
+	return chain[:len(chain):len(chain)]
+}
+
+// 判断path是否在prefix之下，只在路径段的边界上匹配，例如 /admin 不匹配 /administrator
+func matchPrefix(path string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return strings.HasPrefix(path, prefix) && (len(path) == len(prefix) || path[len(prefix)] == '/')
+}
+
+// 收集会作用在host和path上的所有group中间件，只用于没有匹配到路由的请求（404、405、OPTIONS）
+func (engine *Engine) groupMiddlewares(host string, path string) []HandlerFunc {
+	path = normalizePath(path)
 	var middlewares []HandlerFunc
 	for _, group := range engine.groups {
-		if strings.HasPrefix(req.URL.Path, group.prefix) {
+		if group.host != nil && !group.host.match(host, nil) {
+			continue
+		}
+		if matchPrefix(path, group.prefix) {
 			middlewares = append(middlewares, group.middlewares...)
 		}
 	}
-	c := newContext(w, req)
-	c.handlers = middlewares
-	c.engine = engine
+	return middlewares
+}
+
+func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	c := engine.pool.Get().(*Context)
+	c.reset(w, req)
 	engine.router.handle(c)
+	// handler没有写body时，在这里写出延迟的header
+	c.writer.WriteHeaderNow()
+	engine.pool.Put(c)
 }
 
 type MiddlewareChain struct {
@@ -215,3 +442,11 @@ func (engine *Engine) NewMiddlewareChain(middlewares ...HandlerFunc) *Middleware
 	var mc []HandlerFunc
 	return &MiddlewareChain{Middlewares: append(mc, middlewares...)}
 }
+
+// Then 把中间件链和最终的handler拼起来，用于给单个路由加中间件
+// e.g. r.GET("/login", chain.Then(login)...)
+func (mc *MiddlewareChain) Then(handler HandlerFunc) []HandlerFunc {
+	handlers := make([]HandlerFunc, 0, len(mc.Middlewares)+1)
+	handlers = append(handlers, mc.Middlewares...)
+	return append(handlers, handler)
+}
@@ -0,0 +1,50 @@
+package wygo
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMount(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method + " " + r.URL.EscapedPath()))
+	})
+	sub := New()
+	sub.GET("/", func(c *Context) {
+		c.String("sub index")
+	})
+	engine := New()
+	engine.Mount("/mnt", echo)
+	engine.Group("/api").MountEngine("/v2/", sub)
+	engine.GET("/mnt/own", func(c *Context) {
+		c.String("own")
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"GET", "/mnt/a/b", http.StatusOK, "GET /a/b"},
+		// 转义过的/原样交给handler
+		{"GET", "/mnt/a%2Fb/c", http.StatusOK, "GET /a%2Fb/c"},
+		{"GET", "/mnt/dir/", http.StatusOK, "GET /dir/"},
+		{"PROPFIND", "/mnt/x", http.StatusOK, "PROPFIND /x"},
+		{"CONNECT", "/mnt", http.StatusOK, "CONNECT /"},
+		// 单独注册的路由优先
+		{"GET", "/mnt/own", http.StatusOK, "own"},
+		{"POST", "/mnt/own", http.StatusOK, "POST /own"},
+		// prefix末尾有没有/都不会被重定向
+		{"GET", "/mnt/", http.StatusOK, "GET /"},
+		{"GET", "/api/v2", http.StatusOK, "sub index"},
+		{"GET", "/api/v2/", http.StatusOK, "sub index"},
+		{"GET", "/api/v3", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := performRequest(engine, tt.method, "", tt.path)
+		if w.Code != tt.status || tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.path, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+}